@@ -6,7 +6,9 @@ import (
 	"net/http"
 	"os"
 
+	"github.com/simiancreative/treehouse/app/config"
 	"github.com/simiancreative/treehouse/app/contexts"
+	"github.com/simiancreative/treehouse/app/filter"
 	"github.com/simiancreative/treehouse/app/runner"
 	"github.com/simiancreative/treehouse/app/tui"
 
@@ -20,16 +22,33 @@ func New() *Handler {
 type Handler struct {
 	// ConfigDir is the directory containing config files.
 	configDir string
+	// configFiles are loaded instead of the files in configDir when set.
+	configFiles []string
 	// Mode is the mode to run (e.g., dev, prod).
 	mode string
-	// Focus is the service to focus on.
-	focus string
-	// Mute is the service to mute.
-	mute string
+	// Focus holds the services to focus on, as names or glob patterns.
+	focus []string
+	// Mute holds the services to mute, as names or glob patterns.
+	mute []string
 	// tui is the flag to enable the TUI.
 	noTUI bool
 	// spmMode indicates if we're running in single process mode
 	spmMode bool
+	// compose shows the service picker before starting the TUI
+	compose bool
+	// services is the selection of services and modes to run.
+	services []config.Selection
+	// socket is the path of the control API socket; empty disables it.
+	socket string
+	// defaultSocket reports that socket is the default path, which is skipped
+	// rather than failing the run when another treehouse is using it.
+	defaultSocket bool
+	// profile names a profile whose services replace the core services.
+	profile string
+	// with names optional services to run alongside the core services.
+	with []string
+	// withAllOptional runs every optional service alongside the core services.
+	withAllOptional bool
 }
 
 func (h *Handler) SetConfigDir(configDir string) *Handler {
@@ -38,19 +57,25 @@ func (h *Handler) SetConfigDir(configDir string) *Handler {
 	return h
 }
 
+func (h *Handler) SetConfigFiles(configFiles []string) *Handler {
+	h.configFiles = configFiles
+
+	return h
+}
+
 func (h *Handler) SetMode(mode string) *Handler {
 	h.mode = mode
 
 	return h
 }
 
-func (h *Handler) SetFocus(focus string) *Handler {
+func (h *Handler) SetFocus(focus ...string) *Handler {
 	h.focus = focus
 
 	return h
 }
 
-func (h *Handler) SetMute(mute string) *Handler {
+func (h *Handler) SetMute(mute ...string) *Handler {
 	h.mute = mute
 
 	return h
@@ -67,23 +92,151 @@ func (h *Handler) SetSPMMode(spmMode bool) *Handler {
 	return h
 }
 
+func (h *Handler) SetCompose(compose bool) *Handler {
+	h.compose = compose
+	return h
+}
+
+func (h *Handler) SetServices(services []config.Selection) *Handler {
+	h.services = services
+	return h
+}
+
+func (h *Handler) SetSocket(socket string) *Handler {
+	h.socket = socket
+	return h
+}
+
+func (h *Handler) SetDefaultSocket(defaultSocket bool) *Handler {
+	h.defaultSocket = defaultSocket
+	return h
+}
+
+func (h *Handler) SetProfile(profile string) *Handler {
+	h.profile = profile
+	return h
+}
+
+func (h *Handler) SetWith(with []string) *Handler {
+	h.with = with
+	return h
+}
+
+func (h *Handler) SetWithAllOptional(withAllOptional bool) *Handler {
+	h.withAllOptional = withAllOptional
+	return h
+}
+
 func (h *Handler) Run() error {
+	if err := filter.New(h.focus, h.mute).Validate(); err != nil {
+		return err
+	}
+
+	if h.compose {
+		return h.runCompose()
+	}
+
+	if h.profile != "" || len(h.with) > 0 || h.withAllOptional {
+		if err := h.selectServices(); err != nil {
+			return err
+		}
+	}
+
 	if h.noTUI {
 		return h.runServices()
 	}
 
-	return tui.Run(h.configDir, h.mode, h.focus, h.mute)
+	return h.runTUI()
+}
+
+// runTUI runs the selected services in the interactive TUI.
+func (h *Handler) runTUI() error {
+	return tui.Run(tui.Options{
+		ConfigDir:     h.configDir,
+		ConfigFiles:   h.configFiles,
+		Mode:          h.mode,
+		Focus:         h.focus,
+		Mute:          h.mute,
+		Services:      h.services,
+		Socket:        h.socket,
+		DefaultSocket: h.defaultSocket,
+	})
+}
+
+// selectServices builds the selection from the requested profile, or every
+// core service without one, and adds the requested optional services.
+func (h *Handler) selectServices() error {
+	cfg, err := config.Load(h.configDir, h.configFiles, h.mode)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
+	if h.profile != "" {
+		h.services, err = cfg.ProfileSelection(h.profile, h.mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	optional, err := cfg.OptionalSelection(h.with, h.withAllOptional, h.mode)
+	if err != nil {
+		return err
+	}
+
+	if h.profile == "" {
+		h.services = cfg.CoreSelection(h.mode)
+	}
+	for _, sel := range optional {
+		if !selected(h.services, sel.Name) {
+			h.services = append(h.services, sel)
+		}
+	}
+	return nil
+}
+
+// selected reports whether a selection includes the named service.
+func selected(selection []config.Selection, name string) bool {
+	for _, sel := range selection {
+		if sel.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// runCompose lets the user pick services and modes, then runs them in the TUI.
+func (h *Handler) runCompose() error {
+	cfg, err := config.Load(h.configDir, h.configFiles, h.mode)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
+	selection, err := tui.Compose(cfg, h.mode)
+	if err != nil {
+		return err
+	}
+	if len(selection) == 0 {
+		fmt.Println("No services selected")
+		return nil
+	}
+
+	h.services = selection
+	return h.runTUI()
 }
 
 // runServices initializes and runs the service runner.
 func (h *Handler) runServices() error {
 	opts := runner.Options{
-		ConfigDir:  h.configDir,
-		Mode:       h.mode,
-		Focus:      h.focus,
-		Mute:       h.mute,
-		HTTPClient: http.DefaultClient,
-		SPMMode:    h.spmMode,
+		ConfigDir:     h.configDir,
+		ConfigFiles:   h.configFiles,
+		Mode:          h.mode,
+		Focus:         h.focus,
+		Mute:          h.mute,
+		HTTPClient:    http.DefaultClient,
+		SPMMode:       h.spmMode,
+		Services:      h.services,
+		Socket:        h.socket,
+		DefaultSocket: h.defaultSocket,
 	}
 
 	r := runner.New(opts)
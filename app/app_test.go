@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/simiancreative/treehouse/app/config"
+
 	cli "github.com/urfave/cli/v2"
 )
 
@@ -17,18 +19,24 @@ func TestHandlerSetters(t *testing.T) {
 		SetFocus("f").
 		SetMute("u").
 		SetTUI(true).
-		SetSPMMode(true)
+		SetSPMMode(true).
+		SetCompose(true).
+		SetServices([]config.Selection{{Name: "svc", Mode: "m"}}).
+		SetSocket("s.sock").
+		SetProfile("p").
+		SetWith([]string{"opt"}).
+		SetWithAllOptional(true)
 	if h.configDir != "cfg" {
 		t.Errorf("configDir: expected %q, got %q", "cfg", h.configDir)
 	}
 	if h.mode != "m" {
 		t.Errorf("mode: expected %q, got %q", "m", h.mode)
 	}
-	if h.focus != "f" {
-		t.Errorf("focus: expected %q, got %q", "f", h.focus)
+	if len(h.focus) != 1 || h.focus[0] != "f" {
+		t.Errorf("focus: expected [f], got %v", h.focus)
 	}
-	if h.mute != "u" {
-		t.Errorf("mute: expected %q, got %q", "u", h.mute)
+	if len(h.mute) != 1 || h.mute[0] != "u" {
+		t.Errorf("mute: expected [u], got %v", h.mute)
 	}
 	// SetTUI sets the noTUI flag to disable the TUI when true
 	if !h.noTUI {
@@ -38,6 +46,93 @@ func TestHandlerSetters(t *testing.T) {
 	if !h.spmMode {
 		t.Error("spmMode: expected true, got false")
 	}
+	if !h.compose {
+		t.Error("compose: expected true, got false")
+	}
+	if len(h.services) != 1 || h.services[0].Name != "svc" {
+		t.Errorf("services: expected [svc], got %v", h.services)
+	}
+	if h.socket != "s.sock" {
+		t.Errorf("socket: expected %q, got %q", "s.sock", h.socket)
+	}
+	if h.profile != "p" {
+		t.Errorf("profile: expected %q, got %q", "p", h.profile)
+	}
+	if len(h.with) != 1 || h.with[0] != "opt" {
+		t.Errorf("with: expected [opt], got %v", h.with)
+	}
+	if !h.withAllOptional {
+		t.Error("withAllOptional: expected true, got false")
+	}
+}
+
+// TestSelectServices_Optional verifies optional services are added to the
+// core services.
+func TestSelectServices_Optional(t *testing.T) {
+	dir := t.TempDir()
+	config := `core_services:
+  web:
+    command: "echo web"
+optional_services:
+  worker:
+    command: "echo worker"
+  mailer:
+    command: "echo mailer"
+`
+	if err := os.WriteFile(filepath.Join(dir, "treehouse.yaml"), []byte(config), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+
+	h := New().SetConfigDir(dir).SetMode("dev").SetWith([]string{"worker"})
+	if err := h.selectServices(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(h.services) != 2 || h.services[0].Name != "web" || h.services[1].Name != "worker" || h.services[1].Mode != "dev" {
+		t.Errorf("expected web and worker in dev mode, got %+v", h.services)
+	}
+
+	h = New().SetConfigDir(dir).SetWith([]string{"nope"})
+	if err := h.selectServices(); err == nil {
+		t.Error("expected error for unknown optional service")
+	}
+}
+
+// TestSelectServices_Profile verifies a profile replaces the core services.
+func TestSelectServices_Profile(t *testing.T) {
+	dir := t.TempDir()
+	cfg := `core_services:
+  web:
+    command: "echo web"
+  api:
+    command: "echo api"
+    modes:
+      debug: "echo api debug"
+optional_services:
+  worker:
+    command: "echo worker"
+profiles:
+  backend:
+    - service: api
+      mode: debug
+    - worker
+`
+	if err := os.WriteFile(filepath.Join(dir, "treehouse.yaml"), []byte(cfg), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+
+	h := New().SetConfigDir(dir).SetMode("dev").SetProfile("backend").SetWith([]string{"worker"})
+	if err := h.selectServices(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []config.Selection{{Name: "api", Mode: "debug"}, {Name: "worker", Mode: "dev"}}
+	if len(h.services) != len(want) || h.services[0] != want[0] || h.services[1] != want[1] {
+		t.Errorf("expected %+v, got %+v", want, h.services)
+	}
+
+	h = New().SetConfigDir(dir).SetProfile("nope")
+	if err := h.selectServices(); err == nil {
+		t.Error("expected error for unknown profile")
+	}
 }
 
 // helper to suppress stdout and stderr during test
@@ -52,15 +147,17 @@ func suppressOutput(f func()) {
 	f()
 }
 
-// TestRun_Success verifies Run sets environment and returns nil on valid config.
+// TestRun_Success verifies Run passes the service environment to the service
+// without setting it on the process, and returns nil on valid config.
 func TestRun_Success(t *testing.T) {
 	dir := t.TempDir()
 	// Create config file
 	key := "__TEST_APP_RUN__"
 	val := "VALUE"
+	out := filepath.Join(dir, "env.out")
 	config := `core_services:
   svc:
-    command: "echo ok"
+    command: "echo $` + key + ` > ` + out + `"
     env:
       ` + key + `: "` + val + `"
 `
@@ -68,7 +165,7 @@ func TestRun_Success(t *testing.T) {
 	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
 		t.Fatalf("writing config file: %v", err)
 	}
-	defer os.Unsetenv(key)
+	os.Unsetenv(key)
 
 	// disable the TUI to exercise the services-runner path
 	h := New().SetConfigDir(dir).SetMode("test").SetTUI(true)
@@ -77,8 +174,15 @@ func TestRun_Success(t *testing.T) {
 			t.Fatalf("expected nil error, got %v", err)
 		}
 	})
-	if got := os.Getenv(key); got != val {
-		t.Errorf("env var %s: expected %q, got %q", key, val, got)
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("reading service output: %v", err)
+	}
+	if string(got) != val+"\n" {
+		t.Errorf("service env %s: expected %q, got %q", key, val, got)
+	}
+	if got := os.Getenv(key); got != "" {
+		t.Errorf("env var %s: expected unset, got %q", key, got)
 	}
 }
 
@@ -133,3 +237,11 @@ func TestRun_ConfigMissing(t *testing.T) {
 		}
 	})
 }
+
+// TestRun_InvalidPattern verifies Run rejects a malformed focus or mute pattern.
+func TestRun_InvalidPattern(t *testing.T) {
+	h := New().SetConfigDir(t.TempDir()).SetMute("worker-[")
+	if err := h.Run(); err == nil {
+		t.Error("expected error for malformed mute pattern")
+	}
+}
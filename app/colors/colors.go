@@ -19,6 +19,8 @@ const (
    Running            = "#98C379"
    Crashed            = "#E06C75"
    Exited             = "#61AFEF"
+   Restarting         = "#E5C07B"
+   CrashLoop          = "#BE5046"
    Healthy            = "#98C379"
    Unhealthy          = "#E06C75"
 )
\ No newline at end of file
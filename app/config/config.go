@@ -3,36 +3,393 @@ package config
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // ServiceConfig holds the name and command for a service.
 type ServiceConfig struct {
+	Name      string
+	Mode      string
+	Cmd       string
+	DependsOn []Dependency
+	// Env holds the resolved environment for the service, layered on top of
+	// the parent process environment.
+	Env map[string]string
+	// Dir is the working directory of the command; empty uses the current
+	// directory.
+	Dir     string
+	Restart RestartConfig
+	// StopSignal is sent to the process group on shutdown; after StopTimeout
+	// the group is killed.
+	StopSignal  syscall.Signal
+	StopTimeout time.Duration
+}
+
+// Environ returns the parent process environment followed by the service's
+// own variables, so the service values win over inherited ones.
+func (s ServiceConfig) Environ() []string {
+	keys := make([]string, 0, len(s.Env))
+	for k := range s.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	env := os.Environ()
+	for _, k := range keys {
+		env = append(env, k+"="+s.Env[k])
+	}
+	return env
+}
+
+// RestartConfig is the resolved restart policy for a service.
+type RestartConfig struct {
+	Policy string
+	// MaxRetries limits the number of restarts; zero means unlimited.
+	MaxRetries int
+	// Backoff is the delay before the first restart. It doubles for every
+	// exit within the crash-loop window, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// CrashLoopThreshold exits within CrashLoopWindow mark the service as
+	// crash looping.
+	CrashLoopThreshold int
+	CrashLoopWindow    time.Duration
+}
+
+// Selection names a service to run and the mode to run it in. An empty mode
+// runs the service's default command.
+type Selection struct {
 	Name string
-	Cmd  string
+	Mode string
 }
 
 // HealthEntry defines a health check configuration for a service.
 type HealthEntry struct {
-	URL             string `yaml:"url"`
-	Codes           []int  `yaml:"codes"`
+	URL   string `yaml:"url"`
+	Codes []int  `yaml:"codes"`
+	// Method, Headers and Body customize the HTTP request (default GET).
+	Method  string            `yaml:"method,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Body    string            `yaml:"body,omitempty"`
+	// ExpectBody adds assertions on the HTTP response body.
+	ExpectBody *BodyExpectation `yaml:"expect_body,omitempty"`
+	// InsecureSkipVerify accepts self-signed HTTPS certificates.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty"`
+	// TCP is a host:port that counts as healthy once it accepts a connection.
+	TCP string `yaml:"tcp,omitempty"`
+	// Command is a shell command that counts as healthy when it exits 0. Each
+	// attempt is killed after CommandTimeoutSeconds.
+	Command               string `yaml:"command,omitempty"`
+	CommandTimeoutSeconds int    `yaml:"command_timeout_seconds,omitempty"`
+	// LogPattern is a regular expression; the service is healthy once a line
+	// of its output matches it.
+	LogPattern      string `yaml:"log_pattern,omitempty"`
 	IntervalSeconds int    `yaml:"interval_seconds"`
 	TimeoutSeconds  int    `yaml:"timeout_seconds"`
+	// Liveness keeps checking the service after it first becomes healthy.
+	Liveness *LivenessEntry `yaml:"liveness,omitempty"`
+
+	// Dir is the service's working directory, where a command check runs.
+	Dir string `yaml:"-"`
+}
+
+// BodyExpectation lists assertions that must all hold on a response body.
+type BodyExpectation struct {
+	// Contains is a substring the body must contain.
+	Contains string `yaml:"contains,omitempty"`
+	// Regex is a regular expression the body must match.
+	Regex string `yaml:"regex,omitempty"`
+	// JSON maps dotted field paths (such as "checks.db") to the value the
+	// field must equal in the JSON body.
+	JSON map[string]string `yaml:"json,omitempty"`
+}
+
+// LivenessEntry configures ongoing health checks after a service is healthy.
+type LivenessEntry struct {
+	// IntervalSeconds defaults to the health check interval.
+	IntervalSeconds int `yaml:"interval_seconds,omitempty"`
+	// FailureThreshold consecutive failures mark the service Unhealthy.
+	FailureThreshold int `yaml:"failure_threshold,omitempty"`
+	// SuccessThreshold consecutive successes mark it Healthy again.
+	SuccessThreshold int `yaml:"success_threshold,omitempty"`
+	// RestartAfter consecutive failures restart the service; zero never
+	// restarts it.
+	RestartAfter int `yaml:"restart_after,omitempty"`
+}
+
+// UnmarshalYAML decodes a health check and rejects invalid regular expressions.
+func (h *HealthEntry) UnmarshalYAML(node *yaml.Node) error {
+	type plain HealthEntry
+	var p plain
+	if err := node.Decode(&p); err != nil {
+		return err
+	}
+	*h = HealthEntry(p)
+
+	if h.LogPattern != "" {
+		if _, err := regexp.Compile(h.LogPattern); err != nil {
+			return invalidValue(mappingValue(node, "log_pattern"), "invalid log_pattern: %v", err)
+		}
+	}
+	if h.ExpectBody != nil && h.ExpectBody.Regex != "" {
+		if _, err := regexp.Compile(h.ExpectBody.Regex); err != nil {
+			return invalidValue(mappingValue(mappingValue(node, "expect_body"), "regex"), "invalid expect_body regex: %v", err)
+		}
+	}
+	return nil
+}
+
+// invalidValue reports an invalid value at a node as a *yaml.TypeError, so
+// decoding carries on and every invalid value is reported together.
+func invalidValue(node *yaml.Node, format string, args ...any) error {
+	msg := fmt.Sprintf("line %d: ", node.Line) + fmt.Sprintf(format, args...)
+	return &yaml.TypeError{Errors: []string{msg}}
+}
+
+// Enabled reports whether a health check is configured.
+func (h HealthEntry) Enabled() bool {
+	return h.URL != "" || h.TCP != "" || h.Command != "" || h.LogPattern != ""
+}
+
+// Dependency conditions for depends_on entries.
+const (
+	// ConditionStarted waits until the dependency process is running.
+	ConditionStarted = "started"
+	// ConditionHealthy waits until the dependency passes its health check.
+	ConditionHealthy = "healthy"
+)
+
+// Dependency names a service that must reach a condition before the dependent
+// service is started. It may be written as a plain service name, which waits
+// for the dependency to be started.
+type Dependency struct {
+	Service   string `yaml:"service"`
+	Condition string `yaml:"condition,omitempty"`
+}
+
+// UnmarshalYAML accepts either a service name or a mapping with service and condition.
+func (d *Dependency) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*d = Dependency{Service: node.Value, Condition: ConditionStarted}
+		return nil
+	}
+
+	type plain Dependency
+	var p plain
+	if err := node.Decode(&p); err != nil {
+		return err
+	}
+	*d = Dependency(p)
+
+	if d.Service == "" {
+		return invalidValue(node, "depends_on entry requires a service")
+	}
+	switch d.Condition {
+	case "":
+		d.Condition = ConditionStarted
+	case ConditionStarted, ConditionHealthy:
+	default:
+		return invalidValue(mappingValue(node, "condition"), "unknown depends_on condition %q", d.Condition)
+	}
+	return nil
+}
+
+// ProfileEntry names a service in a profile and the mode to run it in. It may
+// be written as a plain service name, which runs in the mode given on the
+// command line.
+type ProfileEntry struct {
+	Service string `yaml:"service"`
+	Mode    string `yaml:"mode,omitempty"`
+}
+
+// UnmarshalYAML accepts either a service name or a mapping with service and mode.
+func (p *ProfileEntry) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*p = ProfileEntry{Service: node.Value}
+		return nil
+	}
+
+	type plain ProfileEntry
+	var pl plain
+	if err := node.Decode(&pl); err != nil {
+		return err
+	}
+	*p = ProfileEntry(pl)
+
+	if p.Service == "" {
+		return invalidValue(node, "profile entry requires a service")
+	}
+	return nil
+}
+
+// default shutdown settings
+const (
+	defaultStopSignal         = syscall.SIGTERM
+	defaultStopTimeoutSeconds = 10
+)
+
+// stopSignals maps the accepted stop_signal names to signals.
+var stopSignals = map[string]syscall.Signal{
+	"SIGTERM": syscall.SIGTERM,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGKILL": syscall.SIGKILL,
+}
+
+// parseStopSignal resolves a stop_signal name such as "SIGINT" or "INT".
+// An empty name is the default SIGTERM.
+func parseStopSignal(name string) (syscall.Signal, error) {
+	if name == "" {
+		return defaultStopSignal, nil
+	}
+	upper := strings.ToUpper(name)
+	if !strings.HasPrefix(upper, "SIG") {
+		upper = "SIG" + upper
+	}
+	sig, ok := stopSignals[upper]
+	if !ok {
+		return 0, fmt.Errorf("unknown stop_signal %q", name)
+	}
+	return sig, nil
+}
+
+// Restart policies.
+const (
+	RestartNo        = "no"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+// default restart settings
+const (
+	defaultRestartBackoffSeconds    = 1
+	defaultRestartMaxBackoffSeconds = 30
+	defaultCrashLoopThreshold       = 5
+	defaultCrashLoopWindowSeconds   = 60
+)
+
+// RestartPolicy configures whether a service is restarted after its command
+// exits. It may be written as just the policy name.
+type RestartPolicy struct {
+	Policy                 string `yaml:"policy"`
+	MaxRetries             int    `yaml:"max_retries"`
+	BackoffSeconds         int    `yaml:"backoff_seconds"`
+	MaxBackoffSeconds      int    `yaml:"max_backoff_seconds"`
+	CrashLoopThreshold     int    `yaml:"crash_loop_threshold"`
+	CrashLoopWindowSeconds int    `yaml:"crash_loop_window_seconds"`
 }
 
-// ServiceMode represents a specific mode configuration for a service
+// UnmarshalYAML accepts either a policy name or a full restart mapping.
+func (r *RestartPolicy) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*r = RestartPolicy{Policy: node.Value}
+	} else {
+		type plain RestartPolicy
+		var p plain
+		if err := node.Decode(&p); err != nil {
+			return err
+		}
+		*r = RestartPolicy(p)
+	}
+
+	switch r.Policy {
+	case "", RestartNo, RestartOnFailure, RestartAlways:
+		return nil
+	default:
+		at := node
+		if node.Kind == yaml.MappingNode {
+			at = mappingValue(node, "policy")
+		}
+		return invalidValue(at, "unknown restart policy %q", r.Policy)
+	}
+}
+
+// resolve fills in defaults and converts the policy to durations.
+func (r RestartPolicy) resolve() RestartConfig {
+	rc := RestartConfig{
+		Policy:             r.Policy,
+		MaxRetries:         r.MaxRetries,
+		Backoff:            time.Duration(r.BackoffSeconds) * time.Second,
+		MaxBackoff:         time.Duration(r.MaxBackoffSeconds) * time.Second,
+		CrashLoopThreshold: r.CrashLoopThreshold,
+		CrashLoopWindow:    time.Duration(r.CrashLoopWindowSeconds) * time.Second,
+	}
+	if rc.Policy == "" {
+		rc.Policy = RestartNo
+	}
+	if rc.Backoff <= 0 {
+		rc.Backoff = defaultRestartBackoffSeconds * time.Second
+	}
+	if rc.MaxBackoff <= 0 {
+		rc.MaxBackoff = defaultRestartMaxBackoffSeconds * time.Second
+	}
+	if rc.MaxBackoff < rc.Backoff {
+		rc.MaxBackoff = rc.Backoff
+	}
+	if rc.CrashLoopThreshold <= 0 {
+		rc.CrashLoopThreshold = defaultCrashLoopThreshold
+	}
+	if rc.CrashLoopWindow <= 0 {
+		rc.CrashLoopWindow = defaultCrashLoopWindowSeconds * time.Second
+	}
+	return rc
+}
+
+// ServiceMode represents a specific mode configuration for a service. It may
+// be written as a plain command string or as a mapping that can also add env
+// vars and replace the health check. An empty command keeps the service's
+// default command.
 type ServiceMode struct {
-	Command string            `yaml:"command"`
-	Env     map[string]string `yaml:"env,omitempty"`
+	Command     string            `yaml:"command"`
+	EnvFile     EnvFiles          `yaml:"env_file,omitempty"`
+	Env         map[string]string `yaml:"env,omitempty"`
+	HealthCheck *HealthEntry      `yaml:"health_check,omitempty"`
+}
+
+// UnmarshalYAML accepts either a command string or a full mode mapping.
+func (m *ServiceMode) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*m = ServiceMode{Command: node.Value}
+		return nil
+	}
+
+	type plain ServiceMode
+	var p plain
+	if err := node.Decode(&p); err != nil {
+		return err
+	}
+	*m = ServiceMode(p)
+	return nil
 }
 
 // Service represents a complete service configuration
 type Service struct {
-	Command     string            `yaml:"command"`
-	Modes       map[string]string `yaml:"modes,omitempty"`
-	Env         map[string]string `yaml:"env,omitempty"`
-	HealthCheck HealthEntry       `yaml:"health_check,omitempty"`
+	Command string `yaml:"command"`
+	// Port is the port the service listens on, referenced elsewhere as
+	// ${service.NAME.port}.
+	Port int `yaml:"port,omitempty"`
+	// Cwd is the working directory of the command, relative to the config
+	// file that declares it.
+	Cwd         string                 `yaml:"cwd,omitempty"`
+	Modes       map[string]ServiceMode `yaml:"modes,omitempty"`
+	EnvFile     EnvFiles               `yaml:"env_file,omitempty"`
+	Env         map[string]string      `yaml:"env,omitempty"`
+	HealthCheck HealthEntry            `yaml:"health_check,omitempty"`
+	DependsOn   []Dependency           `yaml:"depends_on,omitempty"`
+	Restart     RestartPolicy          `yaml:"restart,omitempty"`
+	StopSignal  string                 `yaml:"stop_signal,omitempty"`
+	// StopTimeout is the number of seconds to wait after StopSignal before
+	// killing the service.
+	StopTimeout int `yaml:"stop_timeout,omitempty"`
 }
 
 // Config represents the complete configuration structure
@@ -40,85 +397,325 @@ type Config struct {
 	CoreServices     map[string]Service `yaml:"core_services"`
 	OptionalServices map[string]Service `yaml:"optional_services"`
 	GlobalEnv        map[string]string  `yaml:"global_env,omitempty"`
+	// EnvFile lists dotenv files loaded for every service.
+	EnvFile EnvFiles `yaml:"env_file,omitempty"`
+	// Profiles maps a name to a subset of services to start together.
+	Profiles map[string][]ProfileEntry `yaml:"profiles,omitempty"`
+
+	// dir is the directory of the config file, which relative env_file
+	// paths are resolved against.
+	dir string
+	// envFiles holds the parsed variables of each env file by path.
+	envFiles map[string]map[string]string
+	// envMode is the mode the config was loaded for, whose .env.<mode> file
+	// every service gets, whatever mode its command runs in.
+	envMode string
 }
 
-// LoadConfig loads the consolidated configuration from a YAML file
+// LoadConfig loads the consolidated configuration from a YAML file and the
+// files it includes, without a .env.<mode> file.
 func LoadConfig(configPath string) (*Config, error) {
-	data, err := os.ReadFile(configPath)
+	return LoadFiles("", configPath)
+}
+
+// GetServiceConfig returns the service configuration for a given mode
+func (c *Config) GetServiceConfig(serviceName, mode string) (*ServiceConfig, error) {
+	svc, ok := c.lookup(serviceName)
+	if !ok {
+		return nil, fmt.Errorf("service %s not found", serviceName)
+	}
+
+	cmd := svc.Command
+	if m, ok := svc.mode(mode); ok && m.Command != "" {
+		cmd = m.Command
+	}
+
+	r := c.newResolver(serviceName, mode)
+	cmd, err := expand(cmd, r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, fmt.Errorf("service %s command: %w", serviceName, err)
+	}
+	env, err := r.env()
+	if err != nil {
+		return nil, fmt.Errorf("service %s %w", serviceName, err)
 	}
 
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	stopSignal, err := parseStopSignal(svc.StopSignal)
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", serviceName, err)
+	}
+	stopTimeout := time.Duration(svc.StopTimeout) * time.Second
+	if stopTimeout <= 0 {
+		stopTimeout = defaultStopTimeoutSeconds * time.Second
 	}
 
-	return &config, nil
+	return &ServiceConfig{
+		Name:        serviceName,
+		Mode:        mode,
+		Cmd:         cmd,
+		Dir:         c.servicePath(svc.Cwd),
+		DependsOn:   svc.DependsOn,
+		Env:         env,
+		Restart:     svc.Restart.resolve(),
+		StopSignal:  stopSignal,
+		StopTimeout: stopTimeout,
+	}, nil
 }
 
-// GetServiceConfig returns the service configuration for a given mode
-func (c *Config) GetServiceConfig(serviceName, mode string) (*ServiceConfig, error) {
-	// Check core services first
-	if svc, ok := c.CoreServices[serviceName]; ok {
-		cmd := svc.Command
-		if mode != "" {
-			if modeCmd, ok := svc.Modes[mode]; ok {
-				cmd = modeCmd
+// CoreSelection returns a selection of every core service in the given mode,
+// sorted by service name.
+func (c *Config) CoreSelection(mode string) []Selection {
+	names := make([]string, 0, len(c.CoreServices))
+	for name := range c.CoreServices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	selection := make([]Selection, 0, len(names))
+	for _, name := range names {
+		selection = append(selection, Selection{Name: name, Mode: mode})
+	}
+	return selection
+}
+
+// OptionalSelection returns a selection of the named optional services, or of
+// every optional service when all is set, in the given mode and sorted by
+// service name. It returns an error for a name that is not an optional
+// service.
+func (c *Config) OptionalSelection(names []string, all bool, mode string) ([]Selection, error) {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, ok := c.OptionalServices[name]; !ok {
+			return nil, fmt.Errorf("unknown optional service %s", name)
+		}
+		seen[name] = true
+	}
+	if all {
+		for name := range c.OptionalServices {
+			seen[name] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(seen))
+	for name := range seen {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	selection := make([]Selection, 0, len(sorted))
+	for _, name := range sorted {
+		selection = append(selection, Selection{Name: name, Mode: mode})
+	}
+	return selection, nil
+}
+
+// ProfileSelection returns the selection of a profile in the order it lists
+// its services. Entries without a mode use the given mode. It returns an
+// error for an unknown profile or a profile naming an unknown service.
+func (c *Config) ProfileSelection(name, mode string) ([]Selection, error) {
+	entries, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %s", name)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("profile %s has no services", name)
+	}
+
+	selection := make([]Selection, 0, len(entries))
+	for _, entry := range entries {
+		if _, ok := c.lookup(entry.Service); !ok {
+			return nil, fmt.Errorf("profile %s: unknown service %s", name, entry.Service)
+		}
+		sel := Selection{Name: entry.Service, Mode: entry.Mode}
+		if sel.Mode == "" {
+			sel.Mode = mode
+		}
+		selection = append(selection, sel)
+	}
+	return selection, nil
+}
+
+// ResolveServices returns the service configs for a selection, ordered so that
+// every service comes after the services it depends on. A nil selection
+// resolves every core service in the given mode; an empty one resolves none.
+func (c *Config) ResolveServices(selection []Selection, mode string) ([]ServiceConfig, error) {
+	if selection == nil {
+		selection = c.CoreSelection(mode)
+	}
+
+	services := make([]ServiceConfig, 0, len(selection))
+	for _, sel := range selection {
+		serviceConfig, err := c.GetServiceConfig(sel.Name, sel.Mode)
+		if err != nil {
+			return nil, err
+		}
+		for _, dep := range serviceConfig.DependsOn {
+			if _, ok := c.lookup(dep.Service); !ok {
+				return nil, fmt.Errorf("service %s depends on unknown service %s", sel.Name, dep.Service)
 			}
 		}
-		return &ServiceConfig{
-			Name: serviceName,
-			Cmd:  cmd,
-		}, nil
-	}
-
-	// Check optional services
-	if svc, ok := c.OptionalServices[serviceName]; ok {
-		cmd := svc.Command
-		if mode != "" {
-			if modeCmd, ok := svc.Modes[mode]; ok {
-				cmd = modeCmd
+		services = append(services, *serviceConfig)
+	}
+	return OrderByDependencies(services)
+}
+
+// OrderByDependencies sorts services so that each one follows the services it
+// depends on, keeping the given order where dependencies allow. Dependencies
+// on services outside the list are ignored. It returns an error describing
+// the first dependency cycle found.
+func OrderByDependencies(services []ServiceConfig) ([]ServiceConfig, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	index := make(map[string]int, len(services))
+	for i, svc := range services {
+		index[svc.Name] = i
+	}
+
+	state := make(map[string]int, len(services))
+	ordered := make([]ServiceConfig, 0, len(services))
+	var path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			for i, n := range path {
+				if n == name {
+					cycle := append(append([]string{}, path[i:]...), name)
+					return fmt.Errorf("dependency cycle detected: %s", strings.Join(cycle, " -> "))
+				}
 			}
 		}
-		return &ServiceConfig{
-			Name: serviceName,
-			Cmd:  cmd,
-		}, nil
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range services[index[name]].DependsOn {
+			if _, ok := index[dep.Service]; !ok {
+				continue
+			}
+			if err := visit(dep.Service); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+
+		ordered = append(ordered, services[index[name]])
+		return nil
+	}
+
+	for _, svc := range services {
+		if err := visit(svc.Name); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// lookup returns a core or optional service by name, core services first.
+func (c *Config) lookup(name string) (Service, bool) {
+	if svc, ok := c.CoreServices[name]; ok {
+		return svc, true
 	}
+	svc, ok := c.OptionalServices[name]
+	return svc, ok
+}
 
-	return nil, fmt.Errorf("service %s not found", serviceName)
+// mode returns the named mode of a service, if defined.
+func (s Service) mode(name string) (ServiceMode, bool) {
+	if name == "" {
+		return ServiceMode{}, false
+	}
+	m, ok := s.Modes[name]
+	return m, ok
 }
 
-// GetHealthCheck returns the health check configuration for a service
-func (c *Config) GetHealthCheck(serviceName string) (*HealthEntry, error) {
-	if svc, ok := c.CoreServices[serviceName]; ok {
-		return &svc.HealthCheck, nil
+// GetHealthCheck returns the health check configuration for a service. A
+// mode that defines its own health check replaces the service's one.
+func (c *Config) GetHealthCheck(serviceName, mode string) (*HealthEntry, error) {
+	svc, ok := c.lookup(serviceName)
+	if !ok {
+		return nil, fmt.Errorf("health check for service %s not found", serviceName)
+	}
+
+	hc := svc.HealthCheck
+	if m, ok := svc.mode(mode); ok && m.HealthCheck != nil {
+		hc = *m.HealthCheck
 	}
-	if svc, ok := c.OptionalServices[serviceName]; ok {
-		return &svc.HealthCheck, nil
+
+	hc.Dir = c.servicePath(svc.Cwd)
+
+	r := c.newResolver(serviceName, mode)
+	var err error
+	if hc.URL, err = expand(hc.URL, r); err != nil {
+		return nil, fmt.Errorf("service %s health_check url: %w", serviceName, err)
 	}
-	return nil, fmt.Errorf("health check for service %s not found", serviceName)
+	if hc.TCP, err = expand(hc.TCP, r); err != nil {
+		return nil, fmt.Errorf("service %s health_check tcp: %w", serviceName, err)
+	}
+	return &hc, nil
 }
 
-// GetEnv returns the combined environment variables for a service and mode
+// GetEnv returns the combined environment variables for a service and mode,
+// with references in their values expanded. Values that cannot be resolved
+// are kept as written.
 func (c *Config) GetEnv(serviceName, mode string) map[string]string {
-	env := make(map[string]string)
+	env, _ := c.newResolver(serviceName, mode).env()
+	return env
+}
+
+// envValue is the value of a variable in one layer of a service's
+// environment.
+type envValue struct {
+	value string
+	// literal values come from env files and are used as written
+	literal bool
+}
+
+// rawEnv collects the environment variables for a service and mode as
+// written, with the value of each variable in every layer that sets it,
+// lowest first. Each layer overrides the ones before it: the global env_file
+// entries, the .env.<mode> file next to the config for the mode the config was
+// loaded for, global_env, the service's env_file entries and env, then the
+// mode's env_file entries and env.
+func (c *Config) rawEnv(serviceName, mode string) map[string][]envValue {
+	env := make(map[string][]envValue)
+	set := func(vars map[string]string, literal bool) {
+		for k, v := range vars {
+			env[k] = append(env[k], envValue{value: v, literal: literal})
+		}
+	}
+	files := func(paths ...string) {
+		for _, path := range paths {
+			set(c.envFiles[c.envPath(path)], true)
+		}
+	}
 
 	// Add global environment variables
-	for k, v := range c.GlobalEnv {
-		env[k] = v
+	files(c.EnvFile...)
+	if c.envMode != "" {
+		files(".env." + c.envMode)
+	}
+	set(c.GlobalEnv, false)
+
+	svc, ok := c.lookup(serviceName)
+	if !ok {
+		return env
 	}
 
 	// Add service-specific environment variables
-	if svc, ok := c.CoreServices[serviceName]; ok {
-		for k, v := range svc.Env {
-			env[k] = v
-		}
-	} else if svc, ok := c.OptionalServices[serviceName]; ok {
-		for k, v := range svc.Env {
-			env[k] = v
-		}
+	files(svc.EnvFile...)
+	set(svc.Env, false)
+
+	// Add mode-specific environment variables
+	if m, ok := svc.mode(mode); ok {
+		files(m.EnvFile...)
+		set(m.Env, false)
 	}
 
 	return env
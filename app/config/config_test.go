@@ -3,7 +3,10 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -110,8 +113,8 @@ func TestGetServiceConfig(t *testing.T) {
 		CoreServices: map[string]Service{
 			"web": {
 				Command: "run-web",
-				Modes: map[string]string{
-					"prod": "run-web --prod",
+				Modes: map[string]ServiceMode{
+					"prod": {Command: "run-web --prod"},
 				},
 			},
 		},
@@ -181,7 +184,7 @@ func TestGetHealthCheck(t *testing.T) {
 	}
 
 	// Test core service health check
-	hc, err := config.GetHealthCheck("web")
+	hc, err := config.GetHealthCheck("web", "")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -190,7 +193,7 @@ func TestGetHealthCheck(t *testing.T) {
 	}
 
 	// Test optional service health check
-	hc, err = config.GetHealthCheck("worker")
+	hc, err = config.GetHealthCheck("worker", "")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -199,7 +202,7 @@ func TestGetHealthCheck(t *testing.T) {
 	}
 
 	// Test non-existent service
-	_, err = config.GetHealthCheck("nonexistent")
+	_, err = config.GetHealthCheck("nonexistent", "")
 	if err == nil {
 		t.Fatal("expected error for non-existent service")
 	}
@@ -249,4 +252,573 @@ func TestGetEnv(t *testing.T) {
 	if env["ENVIRONMENT"] != "test" {
 		t.Errorf("got %s, want test", env["ENVIRONMENT"])
 	}
+
+	// Test resolved service config carries the merged env
+	svc, err := config.GetServiceConfig("web", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if svc.Env["PORT"] != "3000" || svc.Env["ENVIRONMENT"] != "test" {
+		t.Errorf("got %v, want PORT=3000 and ENVIRONMENT=test", svc.Env)
+	}
+}
+
+func TestResolveServices(t *testing.T) {
+	config := &Config{
+		CoreServices: map[string]Service{
+			"web": {Command: "run-web", Modes: map[string]ServiceMode{"prod": {Command: "run-web --prod"}}},
+			"api": {Command: "run-api"},
+		},
+		OptionalServices: map[string]Service{
+			"worker": {Command: "run-worker"},
+		},
+	}
+
+	// No selection resolves all core services sorted by name
+	svcs, err := config.ResolveServices(nil, "prod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(svcs) != 2 || svcs[0].Name != "api" || svcs[1].Cmd != "run-web --prod" {
+		t.Errorf("got %+v, want api and web in prod mode", svcs)
+	}
+
+	// Explicit selection uses each service's own mode
+	svcs, err = config.ResolveServices([]Selection{{Name: "worker"}, {Name: "web"}}, "prod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(svcs) != 2 || svcs[0].Cmd != "run-worker" || svcs[1].Cmd != "run-web" {
+		t.Errorf("got %+v, want worker and web in default mode", svcs)
+	}
+
+	// An empty selection resolves nothing
+	svcs, err = config.ResolveServices([]Selection{}, "prod")
+	if err != nil || len(svcs) != 0 {
+		t.Errorf("got %+v, %v, want no services", svcs, err)
+	}
+
+	// Unknown services are rejected
+	if _, err := config.ResolveServices([]Selection{{Name: "nope"}}, ""); err == nil {
+		t.Fatal("expected error for unknown service")
+	}
+}
+
+func TestOptionalSelection(t *testing.T) {
+	config := &Config{
+		CoreServices: map[string]Service{"web": {Command: "run-web"}},
+		OptionalServices: map[string]Service{
+			"worker": {Command: "run-worker"},
+			"mailer": {Command: "run-mailer"},
+		},
+	}
+
+	sel, err := config.OptionalSelection([]string{"worker", "worker"}, false, "dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sel) != 1 || sel[0] != (Selection{Name: "worker", Mode: "dev"}) {
+		t.Errorf("got %+v, want worker in dev mode", sel)
+	}
+
+	// All optional services, sorted by name
+	sel, err = config.OptionalSelection(nil, true, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sel) != 2 || sel[0].Name != "mailer" || sel[1].Name != "worker" {
+		t.Errorf("got %+v, want mailer and worker", sel)
+	}
+
+	// Core and unknown services are rejected
+	for _, name := range []string{"web", "nope"} {
+		if _, err := config.OptionalSelection([]string{name}, false, ""); err == nil {
+			t.Errorf("expected error for %s", name)
+		}
+	}
+}
+
+func TestLoadConfig_Profiles(t *testing.T) {
+	dir := t.TempDir()
+	content := `
+core_services:
+  web:
+    command: "run-web"
+  api:
+    command: "run-api"
+    modes:
+      mock: "run-api --mock"
+profiles:
+  frontend:
+    - web
+    - service: api
+      mode: mock
+`
+	fname := filepath.Join(dir, "treehouse.yaml")
+	if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+
+	config, err := LoadConfig(fname)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sel, err := config.ProfileSelection("frontend", "dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Selection{{Name: "web", Mode: "dev"}, {Name: "api", Mode: "mock"}}
+	if len(sel) != 2 || sel[0] != want[0] || sel[1] != want[1] {
+		t.Errorf("got %+v, want %+v", sel, want)
+	}
+
+	if _, err := config.ProfileSelection("backend", ""); err == nil {
+		t.Error("expected error for unknown profile")
+	}
+	config.Profiles["broken"] = []ProfileEntry{{Service: "nope"}}
+	if _, err := config.ProfileSelection("broken", ""); err == nil {
+		t.Error("expected error for unknown service in profile")
+	}
+	config.Profiles["empty"] = []ProfileEntry{}
+	if _, err := config.ProfileSelection("empty", ""); err == nil {
+		t.Error("expected error for profile without services")
+	}
+}
+
+func TestLoadConfig_DependsOn(t *testing.T) {
+	dir := t.TempDir()
+	content := `core_services:
+  api:
+    command: "run-api"
+    depends_on:
+      - db
+      - service: temporal
+        condition: healthy
+  db:
+    command: "run-db"
+  temporal:
+    command: "run-temporal"
+`
+	fname := filepath.Join(dir, "treehouse.yaml")
+	if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+
+	config, err := LoadConfig(fname)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deps := config.CoreServices["api"].DependsOn
+	want := []Dependency{
+		{Service: "db", Condition: ConditionStarted},
+		{Service: "temporal", Condition: ConditionHealthy},
+	}
+	if len(deps) != len(want) || deps[0] != want[0] || deps[1] != want[1] {
+		t.Errorf("depends_on: got %+v, want %+v", deps, want)
+	}
+
+	// Dependencies are started first
+	svcs, err := config.ResolveServices(nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var order []string
+	for _, svc := range svcs {
+		order = append(order, svc.Name)
+	}
+	if strings.Join(order, ",") != "db,temporal,api" {
+		t.Errorf("start order: got %v, want [db temporal api]", order)
+	}
+}
+
+func TestLoadConfig_DependsOnInvalidCondition(t *testing.T) {
+	dir := t.TempDir()
+	content := `core_services:
+  api:
+    command: "run-api"
+    depends_on:
+      - service: db
+        condition: ready
+`
+	fname := filepath.Join(dir, "treehouse.yaml")
+	if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+
+	if _, err := LoadConfig(fname); err == nil {
+		t.Fatal("expected error for unknown condition")
+	}
+}
+
+func TestResolveServices_DependencyErrors(t *testing.T) {
+	config := &Config{
+		CoreServices: map[string]Service{
+			"a": {Command: "a", DependsOn: []Dependency{{Service: "b"}}},
+			"b": {Command: "b", DependsOn: []Dependency{{Service: "c"}}},
+			"c": {Command: "c", DependsOn: []Dependency{{Service: "a"}}},
+		},
+	}
+
+	_, err := config.ResolveServices(nil, "")
+	if err == nil {
+		t.Fatal("expected error for dependency cycle")
+	}
+	if !strings.Contains(err.Error(), "a -> b -> c -> a") {
+		t.Errorf("expected cycle path in error, got %v", err)
+	}
+
+	config.CoreServices["c"] = Service{Command: "c", DependsOn: []Dependency{{Service: "missing"}}}
+	if _, err := config.ResolveServices(nil, ""); err == nil {
+		t.Fatal("expected error for unknown dependency")
+	}
+}
+
+func TestOrderByDependencies_IgnoresUnselected(t *testing.T) {
+	svcs := []ServiceConfig{
+		{Name: "api", DependsOn: []Dependency{{Service: "db"}, {Service: "cache"}}},
+		{Name: "db"},
+	}
+	ordered, err := OrderByDependencies(svcs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ordered) != 2 || ordered[0].Name != "db" || ordered[1].Name != "api" {
+		t.Errorf("got %+v, want db before api", ordered)
+	}
+}
+
+func TestLoadConfig_StructuredModes(t *testing.T) {
+	dir := t.TempDir()
+	content := `core_services:
+  web:
+    command: "run-web"
+    env:
+      PORT: "3000"
+      AUTH: "off"
+    health_check:
+      url: "http://localhost:3000/health"
+      codes: [200]
+    modes:
+      prod: "run-web --prod"
+      with-auth:
+        env:
+          AUTH: "on"
+        health_check:
+          url: "http://localhost:3000/auth/health"
+          codes: [200, 401]
+      debug:
+        command: "run-web --debug"
+`
+	fname := filepath.Join(dir, "treehouse.yaml")
+	if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+
+	config, err := LoadConfig(fname)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Plain string modes override the command only
+	svc, err := config.GetServiceConfig("web", "prod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if svc.Cmd != "run-web --prod" || svc.Mode != "prod" || svc.Env["AUTH"] != "off" {
+		t.Errorf("prod: got %+v", svc)
+	}
+
+	// Structured modes without a command keep the default command and add env
+	svc, err = config.GetServiceConfig("web", "with-auth")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if svc.Cmd != "run-web" {
+		t.Errorf("with-auth command: got %s, want run-web", svc.Cmd)
+	}
+	if svc.Env["AUTH"] != "on" || svc.Env["PORT"] != "3000" {
+		t.Errorf("with-auth env: got %v", svc.Env)
+	}
+
+	// Mode health checks replace the service health check
+	hc, err := config.GetHealthCheck("web", "with-auth")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hc.URL != "http://localhost:3000/auth/health" || len(hc.Codes) != 2 {
+		t.Errorf("with-auth health check: got %+v", hc)
+	}
+	hc, err = config.GetHealthCheck("web", "debug")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hc.URL != "http://localhost:3000/health" {
+		t.Errorf("debug health check: got %s, want service default", hc.URL)
+	}
+
+	svc, err = config.GetServiceConfig("web", "debug")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if svc.Cmd != "run-web --debug" {
+		t.Errorf("debug command: got %s, want run-web --debug", svc.Cmd)
+	}
+}
+
+func TestLoadConfig_Restart(t *testing.T) {
+	dir := t.TempDir()
+	content := `core_services:
+  web:
+    command: "run-web"
+    restart: on-failure
+  worker:
+    command: "run-worker"
+    restart:
+      policy: always
+      max_retries: 3
+      backoff_seconds: 2
+      max_backoff_seconds: 10
+      crash_loop_threshold: 4
+      crash_loop_window_seconds: 20
+  once:
+    command: "run-once"
+`
+	fname := filepath.Join(dir, "treehouse.yaml")
+	if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+
+	config, err := LoadConfig(fname)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	web, _ := config.GetServiceConfig("web", "")
+	if web.Restart.Policy != RestartOnFailure || web.Restart.Backoff != time.Second || web.Restart.MaxBackoff != 30*time.Second {
+		t.Errorf("web restart: got %+v", web.Restart)
+	}
+
+	worker, _ := config.GetServiceConfig("worker", "")
+	want := RestartConfig{
+		Policy:             RestartAlways,
+		MaxRetries:         3,
+		Backoff:            2 * time.Second,
+		MaxBackoff:         10 * time.Second,
+		CrashLoopThreshold: 4,
+		CrashLoopWindow:    20 * time.Second,
+	}
+	if worker.Restart != want {
+		t.Errorf("worker restart: got %+v, want %+v", worker.Restart, want)
+	}
+
+	once, _ := config.GetServiceConfig("once", "")
+	if once.Restart.Policy != RestartNo {
+		t.Errorf("once restart: got %s, want no", once.Restart.Policy)
+	}
+}
+
+func TestLoadConfig_RestartInvalidPolicy(t *testing.T) {
+	dir := t.TempDir()
+	content := `core_services:
+  web:
+    command: "run-web"
+    restart: sometimes
+`
+	fname := filepath.Join(dir, "treehouse.yaml")
+	if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+
+	if _, err := LoadConfig(fname); err == nil {
+		t.Fatal("expected error for unknown restart policy")
+	}
+}
+
+func TestLoadConfig_InvalidLogPattern(t *testing.T) {
+	dir := t.TempDir()
+	content := `core_services:
+  web:
+    command: "run-web"
+    health_check:
+      log_pattern: "ready ("
+`
+	fname := filepath.Join(dir, "treehouse.yaml")
+	if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+
+	if _, err := LoadConfig(fname); err == nil {
+		t.Fatal("expected error for invalid log_pattern")
+	}
+}
+
+func TestLoadConfig_Liveness(t *testing.T) {
+	dir := t.TempDir()
+	content := `core_services:
+  web:
+    command: "run-web"
+    health_check:
+      url: "http://localhost:3000/health"
+      liveness:
+        interval_seconds: 10
+        failure_threshold: 3
+        success_threshold: 2
+        restart_after: 6
+`
+	fname := filepath.Join(dir, "treehouse.yaml")
+	if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+
+	cfg, err := LoadConfig(fname)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	hc, err := cfg.GetHealthCheck("web", "")
+	if err != nil {
+		t.Fatalf("GetHealthCheck failed: %v", err)
+	}
+	want := LivenessEntry{IntervalSeconds: 10, FailureThreshold: 3, SuccessThreshold: 2, RestartAfter: 6}
+	if hc.Liveness == nil || *hc.Liveness != want {
+		t.Errorf("liveness: expected %+v, got %+v", want, hc.Liveness)
+	}
+}
+
+func TestLoadConfig_HTTPHealthOptions(t *testing.T) {
+	dir := t.TempDir()
+	content := `core_services:
+  web:
+    command: "run-web"
+    health_check:
+      url: "https://localhost:3000/health"
+      method: POST
+      headers:
+        Authorization: "Bearer dev"
+      body: '{"deep":true}'
+      expect_body:
+        contains: "ok"
+        json:
+          status: ok
+          checks.db: up
+      insecure_skip_verify: true
+`
+	fname := filepath.Join(dir, "treehouse.yaml")
+	if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+
+	cfg, err := LoadConfig(fname)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	hc, _ := cfg.GetHealthCheck("web", "")
+	if hc.Method != "POST" || hc.Headers["Authorization"] != "Bearer dev" || hc.Body != `{"deep":true}` || !hc.InsecureSkipVerify {
+		t.Errorf("unexpected request options: %+v", hc)
+	}
+	if hc.ExpectBody == nil || hc.ExpectBody.Contains != "ok" || hc.ExpectBody.JSON["checks.db"] != "up" {
+		t.Errorf("unexpected body expectation: %+v", hc.ExpectBody)
+	}
+
+	content = `core_services:
+  web:
+    command: "run-web"
+    health_check:
+      url: "http://localhost:3000/health"
+      expect_body:
+        regex: "ok("
+`
+	if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+	if _, err := LoadConfig(fname); err == nil {
+		t.Error("expected error for invalid expect_body regex")
+	}
+}
+
+func TestGetServiceConfig_StopSettings(t *testing.T) {
+	config := &Config{
+		CoreServices: map[string]Service{
+			"db":  {Command: "run-db", StopSignal: "SIGINT", StopTimeout: 30},
+			"web": {Command: "run-web"},
+			"bad": {Command: "run-bad", StopSignal: "SIGNOPE"},
+		},
+	}
+
+	db, err := config.GetServiceConfig("db", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if db.StopSignal != syscall.SIGINT || db.StopTimeout != 30*time.Second {
+		t.Errorf("db: got %v after %s, want interrupt after 30s", db.StopSignal, db.StopTimeout)
+	}
+
+	web, err := config.GetServiceConfig("web", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if web.StopSignal != syscall.SIGTERM || web.StopTimeout != 10*time.Second {
+		t.Errorf("web: got %v after %s, want terminated after 10s", web.StopSignal, web.StopTimeout)
+	}
+
+	if _, err := config.GetServiceConfig("bad", ""); err == nil {
+		t.Fatal("expected error for unknown stop signal")
+	}
+}
+
+func TestLoadConfig_StopSettings(t *testing.T) {
+	dir := t.TempDir()
+	content := `core_services:
+  temporal:
+    command: "temporal server start-dev"
+    stop_signal: SIGINT
+    stop_timeout: 15
+`
+	fname := filepath.Join(dir, "treehouse.yaml")
+	if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+
+	config, err := LoadConfig(fname)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc, err := config.GetServiceConfig("temporal", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if svc.StopSignal != syscall.SIGINT || svc.StopTimeout != 15*time.Second {
+		t.Errorf("got %v after %s, want interrupt after 15s", svc.StopSignal, svc.StopTimeout)
+	}
+}
+
+func TestParseStopSignal(t *testing.T) {
+	for name, want := range map[string]syscall.Signal{
+		"":        syscall.SIGTERM,
+		"SIGQUIT": syscall.SIGQUIT,
+		"int":     syscall.SIGINT,
+		"HUP":     syscall.SIGHUP,
+	} {
+		got, err := parseStopSignal(name)
+		if err != nil || got != want {
+			t.Errorf("%q: got %v (%v), want %v", name, got, err, want)
+		}
+	}
+}
+
+func TestHealthEntry_Enabled(t *testing.T) {
+	tests := map[string]struct {
+		entry HealthEntry
+		want  bool
+	}{
+		"empty": {HealthEntry{IntervalSeconds: 1}, false},
+		"url":   {HealthEntry{URL: "http://localhost:3000"}, true},
+		"tcp":   {HealthEntry{TCP: "localhost:5432"}, true},
+		"log":   {HealthEntry{LogPattern: "ready"}, true},
+	}
+	for name, tt := range tests {
+		if got := tt.entry.Enabled(); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", name, tt.want, got)
+		}
+	}
 }
@@ -0,0 +1,285 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvFiles lists dotenv files to load. It may be written as a single path or
+// a list of paths; relative paths are resolved against the config file's
+// directory.
+type EnvFiles []string
+
+// UnmarshalYAML accepts either a single path or a list of paths.
+func (e *EnvFiles) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*e = EnvFiles{node.Value}
+		return nil
+	}
+
+	var paths []string
+	if err := node.Decode(&paths); err != nil {
+		return err
+	}
+	*e = paths
+	return nil
+}
+
+// dotenvError is a syntax error on a line of a dotenv file.
+type dotenvError struct {
+	line int
+	msg  string
+}
+
+func (e *dotenvError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.msg)
+}
+
+// envKey matches a valid variable name.
+var envKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// ReadDotenv reads a dotenv file.
+func ReadDotenv(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	env, err := ParseDotenv(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return env, nil
+}
+
+// ParseDotenv parses dotenv content: one KEY=VALUE per line, with an optional
+// export prefix. Blank lines and lines starting with # are skipped.
+// Unquoted values end at a " #" comment and are trimmed. Single-quoted values
+// are taken literally; double-quoted values expand \n, \r, \t, \" and \\.
+// Quoted values may span multiple lines.
+func ParseDotenv(data string) (map[string]string, error) {
+	env := make(map[string]string)
+	p := dotenvParser{data: strings.ReplaceAll(data, "\r\n", "\n"), line: 1}
+
+	for !p.done() {
+		line := p.line
+		text := strings.TrimSpace(p.readLine())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if rest, ok := strings.CutPrefix(text, "export"); ok && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+			if rest = strings.TrimLeft(rest, " \t"); !strings.HasPrefix(rest, "=") {
+				text = rest
+			}
+		}
+		key, rest, ok := strings.Cut(text, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !envKey.MatchString(key) {
+			return nil, &dotenvError{line: line, msg: "expected KEY=VALUE"}
+		}
+
+		value, err := p.value(strings.TrimLeft(rest, " \t"), line)
+		if err != nil {
+			return nil, err
+		}
+		env[key] = value
+	}
+	return env, nil
+}
+
+// dotenvParser reads dotenv content line by line, letting quoted values
+// continue onto the following lines.
+type dotenvParser struct {
+	data string
+	pos  int
+	line int
+}
+
+func (p *dotenvParser) done() bool {
+	return p.pos >= len(p.data)
+}
+
+// readLine returns the rest of the current line and moves past it.
+func (p *dotenvParser) readLine() string {
+	rest := p.data[p.pos:]
+	text, _, found := strings.Cut(rest, "\n")
+	p.pos += len(text)
+	if found {
+		p.pos++
+		p.line++
+	}
+	return text
+}
+
+// value parses the value starting at rest, the remainder of the line that
+// began at line.
+func (p *dotenvParser) value(rest string, line int) (string, error) {
+	if rest == "" || (rest[0] != '"' && rest[0] != '\'') {
+		if i := strings.Index(rest, " #"); i >= 0 {
+			rest = rest[:i]
+		}
+		return strings.TrimSpace(rest), nil
+	}
+
+	// a quoted value continues onto the following lines until it is closed
+	quote := rest[0]
+	raw := rest[1:]
+	for {
+		if value, tail, ok := closeQuote(raw, quote); ok {
+			tail = strings.TrimSpace(tail)
+			if tail != "" && !strings.HasPrefix(tail, "#") {
+				return "", &dotenvError{line: line, msg: "unexpected text after quoted value"}
+			}
+			return value, nil
+		}
+		if p.done() {
+			return "", &dotenvError{line: line, msg: "unterminated quoted value"}
+		}
+		raw += "\n" + p.readLine()
+	}
+}
+
+// closeQuote finds the closing quote in raw and returns the unquoted value
+// and the text after it.
+func closeQuote(raw string, quote byte) (string, string, bool) {
+	if quote == '\'' {
+		i := strings.IndexByte(raw, '\'')
+		if i < 0 {
+			return "", "", false
+		}
+		return raw[:i], raw[i+1:], true
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '"':
+			return b.String(), raw[i+1:], true
+		case c == '\\' && i+1 < len(raw):
+			i++
+			switch raw[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\':
+				b.WriteByte(raw[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(raw[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", false
+}
+
+// loadEnvFiles reads every env_file in the config and the .env.<mode> file
+// next to the first config file, if there is one, so GetEnv can merge them
+// without touching the filesystem. The files of other modes are not read.
+func (l *loader) loadEnvFiles(root *yaml.Node, c *Config, mode string) {
+	c.envFiles = make(map[string]map[string]string)
+	c.envMode = mode
+
+	for _, n := range envFileNodes(root) {
+		path := c.envPath(n.Value)
+		if _, ok := c.envFiles[path]; ok {
+			continue
+		}
+		env, err := ReadDotenv(path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				l.add(n, "env_file %s does not exist", path)
+			} else {
+				l.addDotenv(n, path, err)
+			}
+			continue
+		}
+		c.envFiles[path] = env
+	}
+
+	if mode == "" {
+		return
+	}
+	path := c.envPath(".env." + mode)
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	env, err := ReadDotenv(path)
+	if err != nil {
+		l.addDotenv(nil, path, err)
+		return
+	}
+	c.envFiles[path] = env
+}
+
+// addDotenv records an error reading a dotenv file at the line of the file
+// it is on, or else at the env_file entry n naming the file.
+func (l *loader) addDotenv(n *yaml.Node, path string, err error) {
+	var syntax *dotenvError
+	switch {
+	case errors.As(err, &syntax):
+		l.issues = append(l.issues, Issue{File: path, Line: syntax.line, Column: 1, Message: syntax.msg})
+	case n != nil:
+		l.add(n, "env_file %s: %v", path, err)
+	default:
+		l.issues = append(l.issues, Issue{File: path, Message: err.Error()})
+	}
+}
+
+// envFileNodes returns the path nodes of every env_file entry in the config:
+// the global ones, and those of each service and each of its modes.
+func envFileNodes(root *yaml.Node) []*yaml.Node {
+	var nodes []*yaml.Node
+	add := func(m *yaml.Node) {
+		files := mappingValue(m, "env_file")
+		switch {
+		case files == nil:
+		case files.Kind == yaml.ScalarNode && !isNull(files) && files.Value != "":
+			nodes = append(nodes, files)
+		case files.Kind == yaml.SequenceNode:
+			for _, f := range files.Content {
+				if f.Kind == yaml.ScalarNode && f.Value != "" {
+					nodes = append(nodes, f)
+				}
+			}
+		}
+	}
+
+	add(root)
+	for _, section := range []string{"core_services", "optional_services"} {
+		services := mappingValue(root, section)
+		if services == nil || services.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 1; i < len(services.Content); i += 2 {
+			svc := services.Content[i]
+			add(svc)
+			if modes := mappingValue(svc, "modes"); modes != nil && modes.Kind == yaml.MappingNode {
+				for j := 1; j < len(modes.Content); j += 2 {
+					add(modes.Content[j])
+				}
+			}
+		}
+	}
+	return nodes
+}
+
+// envPath resolves an env_file path against the config file's directory.
+func (c *Config) envPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.dir, path)
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	content := `# comment
+export API_URL=http://localhost:8081
+export	TABBED=1
+PLAIN = value with spaces   # trailing comment
+HASH=a#b
+EMPTY=
+DOUBLE="line\nbreak \"quoted\""
+SINGLE='literal \n $HOME'
+MULTI="first
+second"
+CERT='-----BEGIN-----
+abc
+-----END-----' # pem
+
+`
+	env, err := ParseDotenv(content)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"API_URL": "http://localhost:8081",
+		"TABBED":  "1",
+		"PLAIN":   "value with spaces",
+		"HASH":    "a#b",
+		"EMPTY":   "",
+		"DOUBLE":  "line\nbreak \"quoted\"",
+		"SINGLE":  `literal \n $HOME`,
+		"MULTI":   "first\nsecond",
+		"CERT":    "-----BEGIN-----\nabc\n-----END-----",
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("got %q, want %q", env, want)
+	}
+}
+
+func TestParseDotenv_Errors(t *testing.T) {
+	for name, content := range map[string]string{
+		"missing equals": "FOO\n",
+		"invalid key":    "1FOO=bar\n",
+		"unterminated":   "FOO=\"bar\nBAZ=1\n",
+		"trailing text":  "FOO=\"bar\" baz\n",
+	} {
+		if _, err := ParseDotenv(content); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadConfig_EnvFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"global.env":  "A=global-file\nB=global-file\nC=global-file\nD=global-file\nE=global-file\n",
+		".env.dev":    "B=mode-file\nC=mode-file\n",
+		"service.env": "D=service-file\nE=service-file\n",
+		"debug.env":   "E=mode-env-file\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+	content := `
+env_file: global.env
+global_env:
+  C: global-env
+core_services:
+  api:
+    command: "run-api"
+    env_file: [service.env]
+    modes:
+      debug:
+        env_file: debug.env
+`
+	fname := filepath.Join(dir, "treehouse.yaml")
+	if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+
+	config, err := LoadFiles("dev", fname)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	env := config.GetEnv("api", "dev")
+	want := map[string]string{"A": "global-file", "B": "mode-file", "C": "global-env", "D": "service-file", "E": "service-file"}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("dev: got %v, want %v", env, want)
+	}
+
+	// .env.dev follows the mode the config was loaded for, not the service's
+	env = config.GetEnv("api", "debug")
+	if env["B"] != "mode-file" || env["E"] != "mode-env-file" {
+		t.Errorf("debug: got %v, want B from .env.dev and E from debug.env", env)
+	}
+	if env = config.GetEnv("api", ""); env["B"] != "mode-file" {
+		t.Errorf("default: got %v, want B from .env.dev", env)
+	}
+}
+
+func TestLoadConfig_MissingEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "treehouse.yaml")
+	if err := os.WriteFile(fname, []byte("env_file: nope.env\n"), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+	if _, err := LoadConfig(fname); err == nil {
+		t.Fatal("expected error for missing env_file")
+	}
+}
+
+func TestLoadConfig_ModeEnvFileRelativeDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "configs"), 0755); err != nil {
+		t.Fatalf("creating configs dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "configs", ".env.dev"), []byte("FROM_MODE=1\n"), 0644); err != nil {
+		t.Fatalf("writing .env.dev: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "configs", "treehouse.yaml"), []byte("core_services:\n  api:\n    command: run\n"), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	config, err := LoadFiles("dev", "configs/treehouse.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env := config.GetEnv("api", "dev"); env["FROM_MODE"] != "1" {
+		t.Errorf("expected FROM_MODE from configs/.env.dev, got %v", env)
+	}
+}
+
+func TestLoad_OnlyRequestedModeEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		DefaultFile:       "core_services:\n  api:\n    command: run\n",
+		".env.dev":        "FROM_MODE=1\n",
+		".env.prod":       "FROM_MODE=1\nnot a dotenv line\n",
+		".env.example":    "not a dotenv file\n",
+		".env.d/base.env": "A=1\n",
+	})
+
+	config, err := Load(dir, nil, "dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env := config.GetEnv("api", "dev"); env["FROM_MODE"] != "1" {
+		t.Errorf("expected FROM_MODE from .env.dev, got %v", env)
+	}
+
+	if _, err := Load(dir, nil, "d"); err != nil {
+		t.Errorf("expected the .env.d directory to be skipped, got %v", err)
+	}
+	if _, err := Load(dir, nil, "prod"); err == nil {
+		t.Error("expected an error for the malformed .env.prod")
+	}
+}
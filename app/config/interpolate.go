@@ -0,0 +1,267 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// expand replaces the ${NAME}, ${NAME:-default} and ${service.NAME.port}
+// references in s. A reference written as $${...} is kept as a literal ${...}.
+func expand(s string, r *resolver) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i])
+			b.WriteString("{")
+			s = s[i+2:]
+			continue
+		}
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated reference in %q", s)
+		}
+		b.WriteString(s[:i])
+
+		ref := s[i+2 : i+end]
+		name, def, hasDefault := strings.Cut(ref, ":-")
+		value, ok, err := r.lookup(name)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case ok && (value != "" || !hasDefault):
+			b.WriteString(value)
+		case hasDefault:
+			b.WriteString(def)
+		default:
+			return "", fmt.Errorf("unresolved reference ${%s}", name)
+		}
+		s = s[i+end+1:]
+	}
+}
+
+// resolver looks up references for one service and mode: variables of its
+// merged environment, then the parent environment, and the declared settings
+// of other services. Environment values may themselves hold references; a
+// value that references its own variable, such as PATH: "${PATH}:/bin", gets
+// the value from the layer below it, or from the parent environment. Values
+// from env files are used as written.
+type resolver struct {
+	c        *Config
+	raw      map[string][]envValue
+	resolved map[layerRef]string
+	visiting map[layerRef]bool
+	// expanding holds the values being expanded, innermost last
+	expanding []layerRef
+}
+
+// layerRef names the value of a variable in one layer of the environment.
+type layerRef struct {
+	name  string
+	layer int
+}
+
+func (c *Config) newResolver(serviceName, mode string) *resolver {
+	return &resolver{
+		c:        c,
+		raw:      c.rawEnv(serviceName, mode),
+		resolved: make(map[layerRef]string),
+		visiting: make(map[layerRef]bool),
+	}
+}
+
+// lookup returns the value of a reference and whether it is set.
+func (r *resolver) lookup(name string) (string, bool, error) {
+	if strings.HasPrefix(name, "service.") {
+		value, err := r.c.serviceSetting(strings.TrimPrefix(name, "service."))
+		return value, err == nil, err
+	}
+
+	layer := len(r.raw[name]) - 1
+	if n := len(r.expanding); n > 0 && r.expanding[n-1].name == name {
+		layer = r.expanding[n-1].layer - 1
+	}
+	return r.resolve(layerRef{name: name, layer: layer})
+}
+
+// resolve expands the value of a variable in one layer. Below the lowest
+// layer is the parent environment.
+func (r *resolver) resolve(ref layerRef) (string, bool, error) {
+	if ref.layer < 0 {
+		value, ok := os.LookupEnv(ref.name)
+		return value, ok, nil
+	}
+	raw := r.raw[ref.name][ref.layer]
+	if raw.literal {
+		return raw.value, true, nil
+	}
+	if value, ok := r.resolved[ref]; ok {
+		return value, true, nil
+	}
+	if r.visiting[ref] {
+		return "", false, fmt.Errorf("reference cycle through ${%s}", ref.name)
+	}
+
+	r.visiting[ref] = true
+	r.expanding = append(r.expanding, ref)
+	value, err := expand(raw.value, r)
+	r.expanding = r.expanding[:len(r.expanding)-1]
+	delete(r.visiting, ref)
+	if err != nil {
+		return "", false, err
+	}
+	r.resolved[ref] = value
+	return value, true, nil
+}
+
+// env expands every variable of the merged environment. Values that cannot
+// be resolved are kept as written, and the first error is returned.
+func (r *resolver) env() (map[string]string, error) {
+	keys := make([]string, 0, len(r.raw))
+	for k := range r.raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	env := make(map[string]string, len(r.raw))
+	var firstErr error
+	for _, k := range keys {
+		top := len(r.raw[k]) - 1
+		value, _, err := r.resolve(layerRef{name: k, layer: top})
+		if err != nil {
+			value = r.raw[k][top].value
+			if firstErr == nil {
+				firstErr = fmt.Errorf("env %s: %w", k, err)
+			}
+		}
+		env[k] = value
+	}
+	return env, firstErr
+}
+
+// serviceSetting resolves a "NAME.setting" reference to a declared setting of
+// another service. Only port is supported.
+func (c *Config) serviceSetting(ref string) (string, error) {
+	i := strings.LastIndexByte(ref, '.')
+	if i < 0 {
+		return "", fmt.Errorf("invalid reference ${service.%s}, expected ${service.NAME.port}", ref)
+	}
+	name, setting := ref[:i], ref[i+1:]
+
+	svc, ok := c.lookup(name)
+	if !ok {
+		return "", fmt.Errorf("reference to unknown service %s", name)
+	}
+	switch setting {
+	case "port":
+		if svc.Port == 0 {
+			return "", fmt.Errorf("service %s has no port", name)
+		}
+		return fmt.Sprint(svc.Port), nil
+	default:
+		return "", fmt.Errorf("unknown service setting %q in ${service.%s}", setting, ref)
+	}
+}
+
+// checkReferences resolves the references of every service in its default
+// mode and in each of its modes, reporting the ones that cannot be resolved
+// at the value that holds them.
+func (l *loader) checkReferences(root *yaml.Node, c *Config) {
+	reported := make(map[*yaml.Node]bool)
+	for _, section := range []string{"core_services", "optional_services"} {
+		services := mappingValue(root, section)
+		if services == nil || services.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(services.Content); i += 2 {
+			name := services.Content[i].Value
+			if _, ok := c.CoreServices[name]; ok && section == "optional_services" {
+				continue
+			}
+
+			svc := services.Content[i+1]
+			l.checkServiceReferences(root, name, svc, "", c, reported)
+			modes := mappingValue(svc, "modes")
+			if modes == nil || modes.Kind != yaml.MappingNode {
+				continue
+			}
+			for j := 0; j+1 < len(modes.Content); j += 2 {
+				l.checkServiceReferences(root, name, svc, modes.Content[j].Value, c, reported)
+			}
+		}
+	}
+}
+
+// checkServiceReferences resolves the command, health check address and
+// environment of a service in a mode. Values already reported, such as those
+// a mode inherits, are skipped.
+func (l *loader) checkServiceReferences(root *yaml.Node, name string, svc *yaml.Node, mode string, c *Config, reported map[*yaml.Node]bool) {
+	var m *yaml.Node
+	if mode != "" {
+		m = mappingValue(mappingValue(svc, "modes"), mode)
+	}
+	report := func(n *yaml.Node, err error) {
+		if err == nil || reported[n] {
+			return
+		}
+		reported[n] = true
+		if mode != "" {
+			l.add(n, "service %s in mode %s: %v", name, mode, err)
+		} else {
+			l.add(n, "service %s: %v", name, err)
+		}
+	}
+	r := c.newResolver(name, mode)
+
+	cmd := mappingValue(svc, "command")
+	if m != nil && m.Kind == yaml.ScalarNode && m.Value != "" {
+		cmd = m
+	} else if mc := mappingValue(m, "command"); mc != nil && mc.Value != "" {
+		cmd = mc
+	}
+	if cmd != nil {
+		_, err := expand(cmd.Value, r)
+		report(cmd, err)
+	}
+
+	hc := mappingValue(svc, "health_check")
+	if mhc := mappingValue(m, "health_check"); mhc != nil && !isNull(mhc) {
+		hc = mhc
+	}
+	for _, key := range []string{"url", "tcp"} {
+		if v := mappingValue(hc, key); v != nil {
+			_, err := expand(v.Value, r)
+			report(v, err)
+		}
+	}
+
+	keys := make([]string, 0, len(r.raw))
+	for k := range r.raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		_, _, err := r.resolve(layerRef{name: k, layer: len(r.raw[k]) - 1})
+		if err == nil {
+			continue
+		}
+		// values from env files are literal, so the value that failed is
+		// set in one of these mappings
+		for _, env := range []*yaml.Node{mappingValue(m, "env"), mappingValue(svc, "env"), mappingValue(root, "global_env")} {
+			if v := mappingValue(env, k); v != nil {
+				report(v, fmt.Errorf("env %s: %w", k, err))
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_Interpolation(t *testing.T) {
+	t.Setenv("TREEHOUSE_TEST_HOST", "example.test")
+	dir := t.TempDir()
+	content := `
+global_env:
+  API_HOST: "${TREEHOUSE_TEST_HOST}"
+core_services:
+  api:
+    command: "api --port ${service.api.port}"
+    port: 8081
+    health_check:
+      url: "http://localhost:${service.api.port}/health"
+      tcp: "localhost:${service.api.port}"
+  ui:
+    command: "vite --port ${PORT} --log ${LOG_LEVEL:-info}"
+    port: 3000
+    env:
+      PORT: "${service.ui.port}"
+      API_URL: "http://${API_HOST}:${service.api.port}"
+      LITERAL: "$${NOT_EXPANDED}"
+    modes:
+      debug:
+        command: "vite --port ${PORT} --log ${LOG_LEVEL}"
+        env:
+          LOG_LEVEL: debug
+`
+	fname := filepath.Join(dir, "treehouse.yaml")
+	if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+
+	config, err := LoadConfig(fname)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ui, err := config.GetServiceConfig("ui", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ui.Cmd != "vite --port 3000 --log info" {
+		t.Errorf("command: got %q", ui.Cmd)
+	}
+	if ui.Env["API_URL"] != "http://example.test:8081" || ui.Env["LITERAL"] != "${NOT_EXPANDED}" {
+		t.Errorf("env: got %v", ui.Env)
+	}
+
+	ui, err = config.GetServiceConfig("ui", "debug")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ui.Cmd != "vite --port 3000 --log debug" {
+		t.Errorf("debug command: got %q", ui.Cmd)
+	}
+
+	hc, err := config.GetHealthCheck("api", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hc.URL != "http://localhost:8081/health" || hc.TCP != "localhost:8081" {
+		t.Errorf("health check: got url %q tcp %q", hc.URL, hc.TCP)
+	}
+}
+
+func TestLoadConfig_SelfReference(t *testing.T) {
+	t.Setenv("TREEHOUSE_TEST_PATH", "/usr/bin")
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".env.dev": "GREETING='hi ${NAME}'\nRAW=\"${TREEHOUSE_TEST_UNSET}\"\n",
+		DefaultFile: `
+global_env:
+  TREEHOUSE_TEST_PATH: "${TREEHOUSE_TEST_PATH}:/global"
+core_services:
+  api:
+    command: "api --greeting \"$GREETING\""
+    env:
+      TREEHOUSE_TEST_PATH: "${TREEHOUSE_TEST_PATH}:/service"
+    modes:
+      dev:
+        command: "api"
+        env:
+          TREEHOUSE_TEST_PATH: "/mode:${TREEHOUSE_TEST_PATH}"
+`,
+	})
+
+	config, err := Load(dir, nil, "dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := config.GetEnv("api", "")["TREEHOUSE_TEST_PATH"]; got != "/usr/bin:/global:/service" {
+		t.Errorf("default: got %q", got)
+	}
+	env := config.GetEnv("api", "dev")
+	if got := env["TREEHOUSE_TEST_PATH"]; got != "/mode:/usr/bin:/global:/service" {
+		t.Errorf("dev: got %q", got)
+	}
+	// env file values are used as written
+	if env["GREETING"] != "hi ${NAME}" || env["RAW"] != "${TREEHOUSE_TEST_UNSET}" {
+		t.Errorf("env file values: got GREETING=%q RAW=%q", env["GREETING"], env["RAW"])
+	}
+}
+
+func TestLoadConfig_InterpolationErrors(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		want    string
+	}{
+		"unset variable": {
+			content: "core_services:\n  api:\n    command: \"api ${TREEHOUSE_TEST_UNSET}\"\n",
+			want:    "unresolved reference ${TREEHOUSE_TEST_UNSET}",
+		},
+		"unknown service": {
+			content: "core_services:\n  api:\n    command: \"api ${service.db.port}\"\n",
+			want:    "unknown service db",
+		},
+		"missing port": {
+			content: "core_services:\n  api:\n    command: \"run\"\n    health_check:\n      url: \"http://localhost:${service.api.port}\"\n",
+			want:    "service api has no port",
+		},
+		"cycle": {
+			content: "core_services:\n  api:\n    command: \"run\"\n    env:\n      A: \"${B}\"\n      B: \"${A}\"\n",
+			want:    "reference cycle",
+		},
+		"unset in mode": {
+			content: "core_services:\n  api:\n    command: \"run\"\n    modes:\n      debug: \"run ${TREEHOUSE_TEST_UNSET}\"\n",
+			want:    "unresolved reference",
+		},
+		"default overridden by every mode": {
+			content: "core_services:\n  api:\n    command: \"run ${service.db.port}\"\n    modes:\n      debug: \"run --debug\"\n",
+			want:    "unknown service db",
+		},
+	}
+	for name, tt := range tests {
+		dir := t.TempDir()
+		fname := filepath.Join(dir, "treehouse.yaml")
+		if err := os.WriteFile(fname, []byte(tt.content), 0644); err != nil {
+			t.Fatalf("writing config file: %v", err)
+		}
+		_, err := LoadConfig(fname)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", name, tt.want, err)
+		}
+	}
+}
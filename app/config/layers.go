@@ -0,0 +1,360 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// config file names looked up in the config directory
+const (
+	DefaultFile = "treehouse.yaml"
+	// LocalFile holds personal, git-ignored overrides merged on top of
+	// DefaultFile.
+	LocalFile = "treehouse.local.yaml"
+)
+
+// Load loads the config from configDir for a mode: DefaultFile with LocalFile
+// merged on top when it exists. When files are given they are loaded instead,
+// in order.
+func Load(configDir string, files []string, mode string) (*Config, error) {
+	if len(files) > 0 {
+		return LoadFiles(mode, files...)
+	}
+
+	paths := []string{filepath.Join(configDir, DefaultFile)}
+	local := filepath.Join(configDir, LocalFile)
+	if _, err := os.Stat(local); err == nil {
+		paths = append(paths, local)
+	}
+	return LoadFiles(mode, paths...)
+}
+
+// LoadFiles loads config files and deep-merges each one on top of the ones
+// before it. Each file's include list is loaded first, so the file's own
+// settings win over the files it includes. Mappings are merged key by key, a
+// null value removes the key, and any other value, including a list, replaces
+// the earlier one. env_file entries are relative to the file that declares
+// them, and the .env.<mode> file for mode is looked up next to the first file.
+//
+// Unknown keys and invalid settings are reported together as a
+// *ValidationError.
+func LoadFiles(mode string, paths ...string) (*Config, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no config file given")
+	}
+
+	l := &loader{files: make(map[*yaml.Node]string), first: paths[0]}
+	var merged *yaml.Node
+	for _, path := range paths {
+		layer, err := l.readLayer(path, nil)
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeNodes(merged, layer)
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(paths[0]))
+	if err != nil {
+		return nil, err
+	}
+	config := Config{dir: dir}
+	l.decode(merged, &config)
+	l.check(merged, &config)
+	l.loadEnvFiles(merged, &config, mode)
+	// references are resolved only once the rest of the config is valid, so a
+	// value that failed to decode or a missing env file is not reported again
+	// as an unresolved reference
+	if len(l.issues) == 0 {
+		l.checkReferences(merged, &config)
+	}
+	if len(l.issues) > 0 {
+		return nil, &ValidationError{Issues: l.issues}
+	}
+
+	return &config, nil
+}
+
+// decode decodes the merged config one top-level key and one service at a
+// time, reporting every value that fails to decode at its position. A service
+// with an invalid value is kept, partly decoded, so the checks can still find
+// it.
+func (l *loader) decode(root *yaml.Node, c *Config) {
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		switch key.Value {
+		case "core_services":
+			c.CoreServices = l.decodeServices(value)
+		case "optional_services":
+			c.OptionalServices = l.decodeServices(value)
+		default:
+			entry := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{key, value}}
+			l.decodeNode(entry, c)
+		}
+	}
+}
+
+// decodeServices decodes a mapping of services.
+func (l *loader) decodeServices(n *yaml.Node) map[string]Service {
+	if n.Kind != yaml.MappingNode {
+		var services map[string]Service
+		l.decodeNode(n, &services)
+		return services
+	}
+
+	services := make(map[string]Service, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		var svc Service
+		l.decodeNode(n.Content[i+1], &svc)
+		services[n.Content[i].Value] = svc
+	}
+	return services
+}
+
+// decodeNode decodes n into out and records its errors as issues.
+func (l *loader) decodeNode(n *yaml.Node, out any) {
+	err := n.Decode(out)
+	var typeErr *yaml.TypeError
+	switch {
+	case err == nil:
+	case errors.As(err, &typeErr):
+		for _, msg := range typeErr.Errors {
+			line, text := splitLine(msg)
+			l.add(nodeAt(n, line), "%s", text)
+		}
+	default:
+		l.add(n, "%v", err)
+	}
+}
+
+// splitLine splits a decode error of the form "line N: message".
+func splitLine(msg string) (int, string) {
+	prefix, text, ok := strings.Cut(msg, ": ")
+	if !ok {
+		return 0, msg
+	}
+	var line int
+	if _, err := fmt.Sscanf(prefix, "line %d", &line); err != nil {
+		return 0, msg
+	}
+	return line, text
+}
+
+// nodeAt returns the last node under n on a line, which for a "key: value"
+// line is the value, or n itself when there is none.
+func nodeAt(n *yaml.Node, line int) *yaml.Node {
+	found := n
+	var walk func(*yaml.Node)
+	walk = func(m *yaml.Node) {
+		if m.Line == line {
+			found = m
+		}
+		for _, child := range m.Content {
+			walk(child)
+		}
+	}
+	walk(n)
+	return found
+}
+
+// loader reads config files, remembering which file each node came from so
+// issues can name it.
+type loader struct {
+	files  map[*yaml.Node]string
+	first  string
+	issues []Issue
+}
+
+// readLayer reads a config file and merges it on top of its includes. stack
+// holds the files including it, to detect include cycles.
+func (l *loader) readLayer(path string, stack []string) (*yaml.Node, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range stack {
+		if p == abs {
+			return nil, fmt.Errorf("include cycle: %s -> %s", strings.Join(stack, " -> "), abs)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("failed to parse config file %s: line %d: expected a mapping", path, root.Line)
+	}
+
+	l.track(root, path)
+	dir := filepath.Dir(abs)
+	resolvePaths(root, dir)
+
+	includes, err := takeIncludes(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	l.checkKeys(root, configType, "")
+
+	var base *yaml.Node
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(dir, include)
+		}
+		layer, err := l.readLayer(include, append(stack, abs))
+		if err != nil {
+			return nil, err
+		}
+		base = mergeNodes(base, layer)
+	}
+	return mergeNodes(base, root), nil
+}
+
+// takeIncludes removes the include key from a config mapping and returns its
+// paths. It may be written as a single path or a list of paths.
+func takeIncludes(root *yaml.Node) ([]string, error) {
+	i := mappingIndex(root, "include")
+	if i < 0 {
+		return nil, nil
+	}
+	value := root.Content[i+1]
+	root.Content = append(root.Content[:i], root.Content[i+2:]...)
+
+	switch {
+	case isNull(value):
+		return nil, nil
+	case value.Kind == yaml.ScalarNode:
+		return []string{value.Value}, nil
+	}
+	var includes []string
+	if err := value.Decode(&includes); err != nil {
+		return nil, fmt.Errorf("line %d: include must be a path or a list of paths", value.Line)
+	}
+	return includes, nil
+}
+
+// mergeNodes merges over on top of base. Mappings are merged key by key and a
+// null value removes the key; anything else replaces the base value.
+func mergeNodes(base, over *yaml.Node) *yaml.Node {
+	if base == nil {
+		return over
+	}
+	if base.Kind != yaml.MappingNode || over.Kind != yaml.MappingNode {
+		return over
+	}
+
+	for j := 0; j < len(over.Content); j += 2 {
+		key, value := over.Content[j], over.Content[j+1]
+		i := mappingIndex(base, key.Value)
+		switch {
+		case isNull(value) && i >= 0:
+			base.Content = append(base.Content[:i], base.Content[i+2:]...)
+		case isNull(value):
+		case i >= 0:
+			base.Content[i+1] = mergeNodes(base.Content[i+1], value)
+		default:
+			base.Content = append(base.Content, key, value)
+		}
+	}
+	return base
+}
+
+// resolvePaths makes the env_file and cwd entries of a config mapping
+// absolute, so they stay relative to the file that declares them once files
+// are merged.
+func resolvePaths(root *yaml.Node, dir string) {
+	resolve := func(m *yaml.Node) {
+		for _, key := range []string{"env_file", "cwd"} {
+			if i := mappingIndex(m, key); i >= 0 {
+				absPaths(m.Content[i+1], dir)
+			}
+		}
+	}
+
+	resolve(root)
+	for _, section := range []string{"core_services", "optional_services"} {
+		services := mappingValue(root, section)
+		if services == nil || services.Kind != yaml.MappingNode {
+			continue
+		}
+		for j := 1; j < len(services.Content); j += 2 {
+			svc := services.Content[j]
+			resolve(svc)
+			modes := mappingValue(svc, "modes")
+			if modes == nil || modes.Kind != yaml.MappingNode {
+				continue
+			}
+			for k := 1; k < len(modes.Content); k += 2 {
+				resolve(modes.Content[k])
+			}
+		}
+	}
+}
+
+// absPaths makes a path scalar, or each path in a sequence, absolute.
+func absPaths(node *yaml.Node, dir string) {
+	if node.Kind == yaml.SequenceNode {
+		for _, n := range node.Content {
+			absPaths(n, dir)
+		}
+		return
+	}
+	if node.Kind == yaml.ScalarNode && !isNull(node) && node.Value != "" && !filepath.IsAbs(node.Value) {
+		node.Value = filepath.Join(dir, node.Value)
+	}
+}
+
+// servicePath resolves a service's cwd against the config file's directory,
+// or the working directory for a config that was not loaded from a file.
+// Paths from loaded files are already absolute.
+func (c *Config) servicePath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	if c.dir != "" {
+		return filepath.Join(c.dir, path)
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// mappingIndex returns the index of a key in a mapping node's content, or -1.
+func mappingIndex(m *yaml.Node, key string) int {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return -1
+	}
+	for i := 0; i < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// mappingValue returns the value of a key in a mapping node, or nil.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if i := mappingIndex(m, key); i >= 0 {
+		return m.Content[i+1]
+	}
+	return nil
+}
+
+// isNull reports whether a node is an explicit null, such as "~" or "null".
+func isNull(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.Tag == "!!null"
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes each file under dir, creating parent directories.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("creating %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+}
+
+func TestLoad_LocalOverride(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		DefaultFile: `
+core_services:
+  api:
+    command: "run-api"
+    env:
+      LOG_LEVEL: info
+      TOKEN: shared
+    depends_on: [db, cache]
+  db:
+    command: "run-db"
+  cache:
+    command: "run-cache"
+global_env:
+  NODE_ENV: development
+`,
+		LocalFile: `
+core_services:
+  api:
+    env:
+      LOG_LEVEL: debug
+      TOKEN: ~
+    depends_on: [db]
+  cache: null
+`,
+	})
+
+	config, err := Load(dir, nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	api := config.CoreServices["api"]
+	if api.Command != "run-api" {
+		t.Errorf("expected command kept from base, got %q", api.Command)
+	}
+	if !reflect.DeepEqual(api.Env, map[string]string{"LOG_LEVEL": "debug"}) {
+		t.Errorf("expected env merged with TOKEN removed, got %v", api.Env)
+	}
+	if len(api.DependsOn) != 1 || api.DependsOn[0].Service != "db" {
+		t.Errorf("expected depends_on replaced, got %+v", api.DependsOn)
+	}
+	if _, ok := config.CoreServices["cache"]; ok {
+		t.Error("expected cache removed by null")
+	}
+	if config.GlobalEnv["NODE_ENV"] != "development" {
+		t.Errorf("expected global_env kept, got %v", config.GlobalEnv)
+	}
+}
+
+func TestLoad_Includes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		DefaultFile: `
+include:
+  - teams/frontend.yaml
+  - teams/backend.yaml
+core_services:
+  api:
+    command: "run-api --from-root"
+`,
+		"teams/frontend.yaml": `
+core_services:
+  ui:
+    command: "run-ui"
+    env_file: ui.env
+`,
+		"teams/ui.env":       "UI_PORT=5173\n",
+		"teams/backend.yaml": "include: shared.yaml\ncore_services:\n  api:\n    command: \"run-api\"\n",
+		"teams/shared.yaml":  "global_env:\n  SHARED: \"1\"\n",
+	})
+
+	config, err := Load(dir, nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.CoreServices["api"].Command != "run-api --from-root" {
+		t.Errorf("expected the including file to win, got %q", config.CoreServices["api"].Command)
+	}
+	if config.GlobalEnv["SHARED"] != "1" {
+		t.Errorf("expected nested include loaded, got %v", config.GlobalEnv)
+	}
+	// env_file is relative to the file that declares it
+	if env := config.GetEnv("ui", ""); env["UI_PORT"] != "5173" {
+		t.Errorf("expected UI_PORT from teams/ui.env, got %v", env)
+	}
+}
+
+func TestLoad_ExplicitFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		DefaultFile: "core_services:\n  api:\n    command: \"ignored\"\n",
+		"a.yaml":    "core_services:\n  api:\n    command: \"run-a\"\n",
+		"b.yaml":    "core_services:\n  api:\n    command: \"run-b\"\n",
+	})
+
+	config, err := Load(dir, []string{filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.CoreServices["api"].Command != "run-b" {
+		t.Errorf("expected the last file to win, got %q", config.CoreServices["api"].Command)
+	}
+}
+
+func TestLoad_IncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		DefaultFile:  "include: other.yaml\n",
+		"other.yaml": "include: treehouse.yaml\n",
+	})
+
+	_, err := Load(dir, nil, "")
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Fatalf("expected include cycle error, got %v", err)
+	}
+}
+
+func TestLoad_Cwd(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"configs/" + DefaultFile: "include: ../teams/api.yaml\n",
+		"teams/api.yaml":         "core_services:\n  api:\n    command: \"go run .\"\n    cwd: ../server\n",
+		"server/main.go":         "package main\n",
+		"other/" + DefaultFile:   "core_services:\n  api:\n    command: run\n    cwd: missing\n",
+		"file/" + DefaultFile:    "core_services:\n  api:\n    command: run\n    cwd: " + DefaultFile + "\n",
+	})
+
+	config, err := Load(filepath.Join(dir, "configs"), nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc, err := config.GetServiceConfig("api", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := filepath.Join(dir, "server"); svc.Dir != want {
+		t.Errorf("expected cwd relative to teams/api.yaml, got %q, want %q", svc.Dir, want)
+	}
+	hc, err := config.GetHealthCheck("api", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hc.Dir != svc.Dir {
+		t.Errorf("expected health check dir %q, got %q", svc.Dir, hc.Dir)
+	}
+
+	for sub, want := range map[string]string{"other": "does not exist", "file": "is not a directory"} {
+		_, err := Load(filepath.Join(dir, sub), nil, "")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", sub, want, err)
+		}
+	}
+}
+
+func TestLoad_RelativeConfigPath(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"configs/" + DefaultFile: "core_services:\n  api:\n    command: run\n    cwd: ../server\n    env_file: api.env\n",
+		"configs/api.env":        "FROM_FILE=1\n",
+		"server/main.go":         "package main\n",
+		"bad/" + DefaultFile:     "core_services:\n  api:\n    command: run\n    cwd: missing\n",
+	})
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	config, err := Load("configs", nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc, err := config.GetServiceConfig("api", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := filepath.Join(dir, "server"); svc.Dir != want {
+		t.Errorf("expected absolute cwd %q, got %q", want, svc.Dir)
+	}
+	if svc.Env["FROM_FILE"] != "1" {
+		t.Errorf("expected FROM_FILE from configs/api.env, got %v", svc.Env)
+	}
+
+	_, err = Load("bad", nil, "")
+	if want := "cwd " + filepath.Join(dir, "bad", "missing") + " does not exist"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("expected error containing %q, got %v", want, err)
+	}
+}
@@ -0,0 +1,390 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Issue is a problem found in a config file.
+type Issue struct {
+	File         string
+	Line, Column int
+	Message      string
+}
+
+func (i Issue) Error() string {
+	if i.Line == 0 {
+		return fmt.Sprintf("%s: %s", i.File, i.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", i.File, i.Line, i.Column, i.Message)
+}
+
+// ValidationError lists every issue found while loading a config.
+type ValidationError struct {
+	Issues []Issue
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Issues)+1)
+	lines = append(lines, fmt.Sprintf("invalid config (%d issues):", len(e.Issues)))
+	for _, issue := range e.Issues {
+		lines = append(lines, "  "+issue.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// configType is the type config files are checked against.
+var configType = reflect.TypeOf(Config{})
+
+// track records the file every node under n came from.
+func (l *loader) track(n *yaml.Node, file string) {
+	l.files[n] = file
+	for _, child := range n.Content {
+		l.track(child, file)
+	}
+}
+
+// add records an issue at the position of a node.
+func (l *loader) add(n *yaml.Node, format string, args ...any) {
+	file, ok := l.files[n]
+	if !ok {
+		file = l.first
+	}
+	l.issues = append(l.issues, Issue{
+		File:    file,
+		Line:    n.Line,
+		Column:  n.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// checkKeys reports mapping keys that do not match a field of the type the
+// node decodes into. Nodes of a different shape are left to the decoder and
+// to the types' own UnmarshalYAML.
+func (l *loader) checkKeys(n *yaml.Node, t reflect.Type, path string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			return
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			field, ok := fields[key.Value]
+			if !ok {
+				l.add(key, "unknown key %q%s%s", key.Value, in(path), suggest(key.Value, fields))
+				continue
+			}
+			l.checkKeys(value, field, join(path, key.Value))
+		}
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			l.checkKeys(n.Content[i+1], t.Elem(), join(path, n.Content[i].Value))
+		}
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, item := range n.Content {
+			l.checkKeys(item, t.Elem(), path)
+		}
+	}
+}
+
+// yamlFields maps the yaml keys of a struct's exported fields to their types.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func in(path string) string {
+	if path == "" {
+		return ""
+	}
+	return " in " + path
+}
+
+// suggest returns a hint naming the known key closest to an unknown one.
+func suggest(key string, fields map[string]reflect.Type) string {
+	best, bestDist := "", 3
+	for name := range fields {
+		d := editDistance(strings.ReplaceAll(key, "_", ""), strings.ReplaceAll(name, "_", ""))
+		if d < bestDist || (d == bestDist && name < best) {
+			best, bestDist = name, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// check runs the semantic checks on the merged config.
+func (l *loader) check(root *yaml.Node, c *Config) {
+	core := mappingValue(root, "core_services")
+	optional := mappingValue(root, "optional_services")
+
+	for _, section := range []*yaml.Node{core, optional} {
+		if section == nil || section.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(section.Content); i += 2 {
+			l.checkService(section.Content[i], section.Content[i+1], c)
+		}
+	}
+
+	if optional != nil {
+		for i := 0; i+1 < len(optional.Content); i += 2 {
+			key := optional.Content[i]
+			if _, ok := c.CoreServices[key.Value]; ok {
+				l.add(key, "service %s is both a core and an optional service", key.Value)
+			}
+		}
+	}
+
+	if profiles := mappingValue(root, "profiles"); profiles != nil && profiles.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(profiles.Content); i += 2 {
+			l.checkProfile(profiles.Content[i], profiles.Content[i+1], c)
+		}
+	}
+
+	l.checkCycles(root)
+}
+
+// checkService checks a service's command, working directory, stop signal,
+// health checks and dependencies.
+func (l *loader) checkService(key, svc *yaml.Node, c *Config) {
+	name := key.Value
+	if cmd := mappingValue(svc, "command"); cmd == nil || strings.TrimSpace(cmd.Value) == "" {
+		at := key
+		if cmd != nil {
+			at = cmd
+		}
+		l.add(at, "service %s has no command", name)
+	}
+
+	if cwd := mappingValue(svc, "cwd"); cwd != nil && cwd.Value != "" {
+		if info, err := os.Stat(cwd.Value); err != nil {
+			l.add(cwd, "service %s: cwd %s does not exist", name, cwd.Value)
+		} else if !info.IsDir() {
+			l.add(cwd, "service %s: cwd %s is not a directory", name, cwd.Value)
+		}
+	}
+
+	if sig := mappingValue(svc, "stop_signal"); sig != nil && sig.Value != "" {
+		if _, err := parseStopSignal(sig.Value); err != nil {
+			l.add(sig, "service %s: %v", name, err)
+		}
+	}
+
+	l.checkHealth(name, mappingValue(svc, "health_check"))
+	if modes := mappingValue(svc, "modes"); modes != nil && modes.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(modes.Content); i += 2 {
+			l.checkHealth(name, mappingValue(modes.Content[i+1], "health_check"))
+		}
+	}
+
+	for _, dep := range dependencyNodes(svc) {
+		switch _, ok := c.lookup(dep.Value); {
+		case dep.Value == name:
+			l.add(dep, "service %s depends on itself", name)
+		case !ok:
+			l.add(dep, "service %s depends on unknown service %s", name, dep.Value)
+		}
+	}
+}
+
+// checkHealth reports health check codes that are not HTTP status codes and a
+// liveness setting on a log pattern check, which only matches once at start.
+func (l *loader) checkHealth(name string, hc *yaml.Node) {
+	if live := mappingValue(hc, "liveness"); live != nil && !isNull(live) {
+		if pattern := mappingValue(hc, "log_pattern"); pattern != nil && pattern.Value != "" {
+			l.add(live, "service %s: liveness does not apply to a log_pattern health check", name)
+		}
+	}
+
+	codes := mappingValue(hc, "codes")
+	if codes == nil || codes.Kind != yaml.SequenceNode {
+		return
+	}
+	for _, code := range codes.Content {
+		if n, err := strconv.Atoi(code.Value); err != nil || n < 100 || n > 599 {
+			l.add(code, "service %s: invalid health check code %s, expected 100-599", name, code.Value)
+		}
+	}
+}
+
+// checkProfile checks that a profile names at least one service, and only
+// known services and modes.
+func (l *loader) checkProfile(key, entries *yaml.Node, c *Config) {
+	name := key.Value
+	if isNull(entries) || (entries.Kind == yaml.SequenceNode && len(entries.Content) == 0) {
+		l.add(key, "profile %s has no services", name)
+		return
+	}
+	if entries.Kind != yaml.SequenceNode {
+		return
+	}
+	for _, entry := range entries.Content {
+		svcNode, modeNode := entry, (*yaml.Node)(nil)
+		if entry.Kind == yaml.MappingNode {
+			svcNode, modeNode = mappingValue(entry, "service"), mappingValue(entry, "mode")
+			if svcNode == nil {
+				continue
+			}
+		}
+
+		svc, ok := c.lookup(svcNode.Value)
+		if !ok {
+			l.add(svcNode, "profile %s: unknown service %s", name, svcNode.Value)
+			continue
+		}
+		if modeNode != nil && modeNode.Value != "" {
+			if _, ok := svc.Modes[modeNode.Value]; !ok {
+				l.add(modeNode, "profile %s: service %s has no mode %s", name, svcNode.Value, modeNode.Value)
+			}
+		}
+	}
+}
+
+// checkCycles reports a dependency cycle among all services at the
+// depends_on entry that closes it. Services that depend on themselves are
+// already reported by checkService.
+func (l *loader) checkCycles(root *yaml.Node) {
+	// deps holds the depends_on entries of each service, core services
+	// taking precedence like lookup
+	deps := make(map[string][]*yaml.Node)
+	var names []string
+	for _, section := range []string{"core_services", "optional_services"} {
+		services := mappingValue(root, section)
+		if services == nil || services.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(services.Content); i += 2 {
+			name := services.Content[i].Value
+			if _, ok := deps[name]; ok {
+				continue
+			}
+			names = append(names, name)
+			deps[name] = dependencyNodes(services.Content[i+1])
+		}
+	}
+	sort.Strings(names)
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(names))
+	var path []string
+
+	var visit func(name string) bool
+	visit = func(name string) bool {
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range deps[name] {
+			if _, ok := deps[dep.Value]; !ok || dep.Value == name {
+				continue
+			}
+			switch state[dep.Value] {
+			case visiting:
+				for i, n := range path {
+					if n == dep.Value {
+						cycle := append(append([]string{}, path[i:]...), dep.Value)
+						l.add(dep, "dependency cycle detected: %s", strings.Join(cycle, " -> "))
+						break
+					}
+				}
+				return false
+			case 0:
+				if !visit(dep.Value) {
+					return false
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return true
+	}
+
+	for _, name := range names {
+		if state[name] == 0 && !visit(name) {
+			return
+		}
+	}
+}
+
+// dependencyNodes returns the service name nodes of a service's depends_on
+// entries, written either as a name or as a mapping with a service key.
+func dependencyNodes(svc *yaml.Node) []*yaml.Node {
+	deps := mappingValue(svc, "depends_on")
+	if deps == nil || deps.Kind != yaml.SequenceNode {
+		return nil
+	}
+	nodes := make([]*yaml.Node, 0, len(deps.Content))
+	for _, dep := range deps.Content {
+		if dep.Kind == yaml.MappingNode {
+			dep = mappingValue(dep, "service")
+			if dep == nil {
+				continue
+			}
+		}
+		nodes = append(nodes, dep)
+	}
+	return nodes
+}
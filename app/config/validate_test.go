@@ -0,0 +1,214 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadFiles_Validation(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		DefaultFile: `include: extra.yaml
+core_services:
+  api:
+    command: "run-api"
+    healthcheck:
+      url: "http://localhost:8081"
+    health_check:
+      codes: [200, 42]
+      log_pattern: "ready"
+      liveness:
+        interval_seconds: 5
+    depends_on: [api, db]
+  web:
+    command: ""
+profiles:
+  dev:
+    - nope
+    - service: api
+      mode: missing
+  empty: []
+`,
+		"extra.yaml": `optional_services:
+  api:
+    command: "run-api"
+    health_check:
+      interval_second: 2
+`,
+	})
+
+	_, err := Load(dir, nil, "")
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+
+	base := filepath.Join(dir, DefaultFile)
+	extra := filepath.Join(dir, "extra.yaml")
+	want := []string{
+		base + `:5:5: unknown key "healthcheck" in core_services.api, did you mean "health_check"?`,
+		extra + `:5:7: unknown key "interval_second" in optional_services.api.health_check, did you mean "interval_seconds"?`,
+		base + ":8:20: service api: invalid health check code 42, expected 100-599",
+		base + ":11:9: service api: liveness does not apply to a log_pattern health check",
+		base + ":12:18: service api depends on itself",
+		base + ":12:23: service api depends on unknown service db",
+		base + ":14:14: service web has no command",
+		extra + ":2:3: service api is both a core and an optional service",
+		base + ":17:7: profile dev: unknown service nope",
+		base + ":19:13: profile dev: service api has no mode missing",
+		base + ":20:3: profile empty has no services",
+	}
+	got := make([]string, len(verr.Issues))
+	for i, issue := range verr.Issues {
+		got[i] = issue.Error()
+	}
+	for _, w := range want {
+		if !contains(got, w) {
+			t.Errorf("missing issue %q", w)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("expected %d issues, got %d:\n%s", len(want), len(got), strings.Join(got, "\n"))
+	}
+}
+
+func TestLoadFiles_DependencyCycle(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, DefaultFile)
+	content := "core_services:\n  a:\n    command: run\n    depends_on: [b]\n  b:\n    command: run\n    depends_on: [a]\n"
+	if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+
+	_, err := LoadConfig(fname)
+	want := fname + ":7:18: dependency cycle detected: a -> b -> a"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("expected %q, got %v", want, err)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLoadFiles_DecodeIssues(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		DefaultFile: `core_services:
+  api:
+    command: "run-api"
+    port: eighty
+    restart: sometimes
+    stop_signal: SIGFOO
+    env_file: missing.env
+    health_check:
+      log_pattern: "("
+  web:
+    command: "run-web"
+    portt: 8080
+    depends_on:
+      - service: api
+        condition: eventually
+`,
+	})
+
+	_, err := Load(dir, nil, "")
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+
+	base := filepath.Join(dir, DefaultFile)
+	want := []string{
+		base + ":4:11: cannot unmarshal !!str `eighty` into int",
+		base + `:5:14: unknown restart policy "sometimes"`,
+		base + ":9:20: invalid log_pattern: error parsing regexp: missing closing ): `(`",
+		base + `:12:5: unknown key "portt" in core_services.web, did you mean "port"?`,
+		base + `:15:20: unknown depends_on condition "eventually"`,
+		base + `:6:18: service api: unknown stop_signal "SIGFOO"`,
+		base + ":7:15: env_file " + filepath.Join(dir, "missing.env") + " does not exist",
+	}
+	got := make([]string, len(verr.Issues))
+	for i, issue := range verr.Issues {
+		got[i] = issue.Error()
+	}
+	for _, w := range want {
+		if !contains(got, w) {
+			t.Errorf("missing issue %q", w)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("expected %d issues, got %d:\n%s", len(want), len(got), strings.Join(got, "\n"))
+	}
+}
+
+func TestLoadFiles_ReferenceIssues(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		DefaultFile: `global_env:
+  SHARED: "${TREEHOUSE_TEST_UNSET}"
+core_services:
+  api:
+    command: "run-api --port ${PORT}"
+    env:
+      PORT: "${service.db.port}"
+    modes:
+      dev:
+        health_check:
+          url: "http://localhost:${DEV_PORT}"
+`,
+		".env.dev": "OK=1\nBROKEN\n",
+	})
+
+	_, err := Load(dir, nil, "dev")
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+
+	base := filepath.Join(dir, DefaultFile)
+	want := []string{
+		filepath.Join(dir, ".env.dev") + ":2:1: expected KEY=VALUE",
+	}
+	got := make([]string, len(verr.Issues))
+	for i, issue := range verr.Issues {
+		got[i] = issue.Error()
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, ".env.dev"), []byte("OK=1\n"), 0644); err != nil {
+		t.Fatalf("writing env file: %v", err)
+	}
+	_, err = Load(dir, nil, "dev")
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	want = []string{
+		base + ":5:14: service api: reference to unknown service db",
+		base + ":7:13: service api: env PORT: reference to unknown service db",
+		base + ":2:11: service api: env SHARED: unresolved reference ${TREEHOUSE_TEST_UNSET}",
+		base + ":11:16: service api in mode dev: unresolved reference ${DEV_PORT}",
+	}
+	got = make([]string, len(verr.Issues))
+	for i, issue := range verr.Issues {
+		got[i] = issue.Error()
+	}
+	for _, w := range want {
+		if !contains(got, w) {
+			t.Errorf("missing issue %q", w)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("expected %d issues, got %d:\n%s", len(want), len(got), strings.Join(got, "\n"))
+	}
+}
@@ -0,0 +1,137 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// Client talks to the control API of a running treehouse.
+type Client struct {
+	path string
+	http *http.Client
+}
+
+// NewClient creates a client for the socket at path.
+func NewClient(path string) *Client {
+	return &Client{
+		path: path,
+		http: &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		}},
+	}
+}
+
+// List returns the state of every service.
+func (c *Client) List(ctx context.Context) ([]ServiceInfo, error) {
+	var infos []ServiceInfo
+	if err := c.do(ctx, http.MethodGet, "/services", &infos); err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// Restart restarts a service and returns its state afterwards.
+func (c *Client) Restart(ctx context.Context, name string) (ServiceInfo, error) {
+	var info ServiceInfo
+	err := c.do(ctx, http.MethodPost, "/services/"+url.PathEscape(name)+"/restart", &info)
+	return info, err
+}
+
+// Logs writes the buffered output of a service to w. With follow set it keeps
+// writing new lines until ctx is canceled or treehouse exits.
+func (c *Client) Logs(ctx context.Context, name string, follow bool, w io.Writer) error {
+	path := "/services/" + url.PathEscape(name) + "/logs"
+	if follow {
+		path += "?follow=1"
+	}
+
+	resp, err := c.send(ctx, http.MethodGet, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fmt.Fprintln(w, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("reading logs: %w", err)
+	}
+	return nil
+}
+
+// do sends a request and decodes the JSON response into out.
+func (c *Client) do(ctx context.Context, method, path string, out any) error {
+	resp, err := c.send(ctx, method, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+// send performs a request and turns API errors into Go errors.
+func (c *Client) send(ctx context.Context, method, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, "http://treehouse"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ECONNREFUSED) {
+			return nil, fmt.Errorf("no running treehouse found at %s", c.path)
+		}
+		return nil, fmt.Errorf("connecting to treehouse: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var body errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error == "" {
+			return nil, fmt.Errorf("treehouse returned %s", resp.Status)
+		}
+		return nil, errors.New(body.Error)
+	}
+
+	return resp, nil
+}
+
+// WriteStatus prints services as a table with their state, PID, uptime and
+// health.
+func WriteStatus(w io.Writer, infos []ServiceInfo, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tSTATE\tPID\tUPTIME\tHEALTH\tRESTARTS")
+	for _, info := range infos {
+		pid, uptime, health := "-", "-", "-"
+		if info.PID != 0 {
+			pid = fmt.Sprint(info.PID)
+			if info.StartedAt != nil {
+				uptime = now.Sub(*info.StartedAt).Truncate(time.Second).String()
+			}
+		}
+		if info.Health != "" {
+			health = info.Health
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\n", info.Name, info.Status, pid, uptime, health, info.Restarts)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,106 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simiancreative/treehouse/app/config"
+	"github.com/simiancreative/treehouse/app/supervisor"
+)
+
+// TestClient talks to a running server over its socket.
+func TestClient(t *testing.T) {
+	sup := supervisor.New(supervisor.Options{Services: []config.ServiceConfig{
+		{Name: "a", Cmd: "echo hello; " + loop},
+	}})
+	path := filepath.Join(t.TempDir(), DefaultSocket)
+	srv, err := Listen(path, sup)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	sup.StartAll()
+	defer func() {
+		sup.StopAll()
+		srv.Close()
+	}()
+	waitFor(t, "a running", running(sup, "a"))
+
+	client := NewClient(path)
+	ctx := context.Background()
+
+	infos, err := client.List(ctx)
+	if err != nil || len(infos) != 1 || infos[0].Name != "a" {
+		t.Fatalf("list: expected service a, got %+v, %v", infos, err)
+	}
+	firstPID := infos[0].PID
+
+	info, err := client.Restart(ctx, "a")
+	if err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	if info.Name != "a" {
+		t.Errorf("restart: expected service a, got %+v", info)
+	}
+	waitFor(t, "a running again", func() bool {
+		info, _ := sup.Status("a")
+		return info.Status == "Running" && info.PID != firstPID
+	})
+
+	if _, err := client.Restart(ctx, "nope"); err == nil || !strings.Contains(err.Error(), "unknown service") {
+		t.Errorf("expected unknown service error, got %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := client.Logs(ctx, "a", false, &out); err != nil {
+		t.Fatalf("logs: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "hello\n") {
+		t.Errorf("expected buffered output, got %q", out.String())
+	}
+
+	followCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	out.Reset()
+	if err := client.Logs(followCtx, "a", true, &out); err != nil {
+		t.Errorf("follow: expected nil on cancel, got %v", err)
+	}
+}
+
+// TestClient_NotRunning reports a missing treehouse clearly.
+func TestClient_NotRunning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultSocket)
+	_, err := NewClient(path).List(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "no running treehouse") {
+		t.Errorf("expected no running treehouse error, got %v", err)
+	}
+}
+
+// TestWriteStatus formats services as a table.
+func TestWriteStatus(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	started := now.Add(-90 * time.Second)
+	infos := []ServiceInfo{
+		{Name: "api", Status: "Running", PID: 42, StartedAt: &started, Health: "Healthy", Restarts: 1},
+		{Name: "web", Status: "Exited"},
+	}
+
+	var out bytes.Buffer
+	if err := WriteStatus(&out, infos, now); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header and two rows, got %q", out.String())
+	}
+	if got := strings.Fields(lines[1]); strings.Join(got, " ") != "api Running 42 1m30s Healthy 1" {
+		t.Errorf("unexpected api row %q", lines[1])
+	}
+	if got := strings.Fields(lines[2]); strings.Join(got, " ") != "web Exited - - - 0" {
+		t.Errorf("unexpected web row %q", lines[2])
+	}
+}
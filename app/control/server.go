@@ -0,0 +1,256 @@
+// Package control serves a JSON API on a Unix domain socket so that a running
+// treehouse can be inspected and controlled from other processes.
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/simiancreative/treehouse/app/supervisor"
+)
+
+// DefaultSocket is the socket file name created in the config directory.
+const DefaultSocket = ".treehouse.sock"
+
+// SocketPath returns the default socket path for a config directory, so every
+// treehouse command run against the same project finds the same socket.
+func SocketPath(configDir string) string {
+	return filepath.Join(configDir, DefaultSocket)
+}
+
+// Services is the state and control surface exposed by the API. It is
+// implemented by *supervisor.Supervisor.
+type Services interface {
+	List() []supervisor.Info
+	Status(name string) (supervisor.Info, error)
+	Start(name string) error
+	Stop(name string) error
+	Restart(name string) error
+	Logs(name string) ([]string, error)
+	Subscribe(name string) ([]string, <-chan string, func(), error)
+}
+
+// ServiceInfo is the JSON representation of a service's state.
+type ServiceInfo struct {
+	Name      string     `json:"name"`
+	Mode      string     `json:"mode"`
+	Status    string     `json:"status"`
+	Health    string     `json:"health,omitempty"`
+	PID       int        `json:"pid,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	Restarts  int        `json:"restarts"`
+	Active    bool       `json:"active"`
+}
+
+// errorResponse is the body returned for failed requests.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func newServiceInfo(info supervisor.Info) ServiceInfo {
+	out := ServiceInfo{
+		Name:     info.Name,
+		Mode:     info.Mode,
+		Status:   info.Status,
+		Health:   info.Health,
+		PID:      info.PID,
+		Restarts: info.Restarts,
+		Active:   info.Active,
+	}
+	if !info.StartedAt.IsZero() {
+		startedAt := info.StartedAt
+		out.StartedAt = &startedAt
+	}
+	return out
+}
+
+// Server serves the control API.
+type Server struct {
+	path     string
+	services Services
+	listener net.Listener
+	http     *http.Server
+}
+
+// ErrInUse is returned by Listen when another treehouse is listening on the
+// socket.
+var ErrInUse = errors.New("in use by another treehouse")
+
+// Listen creates the socket at path and serves the API in the background. A
+// stale socket left behind by a previous run is removed; an error wrapping
+// ErrInUse is returned if another treehouse instance is still listening on it.
+func Listen(path string, services Services) (*Server, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control socket %s is %w", path, ErrInUse)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale control socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listening on control socket: %w", err)
+	}
+
+	s := &Server{
+		path:     path,
+		services: services,
+		listener: listener,
+	}
+	s.http = &http.Server{Handler: s.Handler()}
+
+	go s.http.Serve(listener)
+
+	return s, nil
+}
+
+// Close stops serving and removes the socket file.
+func (s *Server) Close() error {
+	err := s.http.Close()
+	os.Remove(s.path)
+	return err
+}
+
+// Handler returns the API routes:
+//
+//	GET  /services                  list every service
+//	GET  /services/{name}           a single service
+//	POST /services/{name}/start     start a stopped service
+//	POST /services/{name}/stop      stop a service
+//	POST /services/{name}/restart   restart a service
+//	GET  /services/{name}/logs      buffered output; ?follow=1 streams new lines, ?tail=N limits
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /services", s.list)
+	mux.HandleFunc("GET /services/{name}", s.status)
+	mux.HandleFunc("POST /services/{name}/start", s.action(s.services.Start))
+	mux.HandleFunc("POST /services/{name}/stop", s.action(s.services.Stop))
+	mux.HandleFunc("POST /services/{name}/restart", s.action(s.services.Restart))
+	mux.HandleFunc("GET /services/{name}/logs", s.logs)
+	return mux
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	infos := s.services.List()
+	out := make([]ServiceInfo, 0, len(infos))
+	for _, info := range infos {
+		out = append(out, newServiceInfo(info))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	info, err := s.services.Status(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newServiceInfo(info))
+}
+
+// action runs a control function on the named service and responds with the
+// service's state afterwards.
+func (s *Server) action(fn func(name string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if err := fn(name); err != nil {
+			writeError(w, err)
+			return
+		}
+		s.status(w, r)
+	}
+}
+
+// logs writes the buffered output of a service as plain text, one line per
+// log line. With follow set, new lines are streamed until the client
+// disconnects.
+func (s *Server) logs(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	tail := -1
+	if v := r.URL.Query().Get("tail"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "tail must be a non-negative number"})
+			return
+		}
+		tail = n
+	}
+	follow, _ := strconv.ParseBool(r.URL.Query().Get("follow"))
+
+	var (
+		lines       []string
+		stream      <-chan string
+		unsubscribe func()
+		err         error
+	)
+	if follow {
+		lines, stream, unsubscribe, err = s.services.Subscribe(name)
+	} else {
+		lines, err = s.services.Logs(name)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if unsubscribe != nil {
+		defer unsubscribe()
+	}
+
+	if tail >= 0 && tail < len(lines) {
+		lines = lines[len(lines)-tail:]
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+	if !follow {
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line := <-stream:
+			fmt.Fprintln(w, line)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError maps supervisor errors to HTTP status codes.
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, supervisor.ErrUnknownService):
+		code = http.StatusNotFound
+	case errors.Is(err, supervisor.ErrAlreadyRunning):
+		code = http.StatusConflict
+	}
+	writeJSON(w, code, errorResponse{Error: err.Error()})
+}
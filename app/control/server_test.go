@@ -0,0 +1,204 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simiancreative/treehouse/app/config"
+	"github.com/simiancreative/treehouse/app/supervisor"
+)
+
+const loop = "while true; do sleep 0.05; done"
+
+// serve starts a supervisor and a control server on a temporary socket and
+// returns an HTTP client connected to it.
+func serve(t *testing.T, svcs ...config.ServiceConfig) (*supervisor.Supervisor, *http.Client) {
+	t.Helper()
+	sup := supervisor.New(supervisor.Options{Services: svcs})
+	path := filepath.Join(t.TempDir(), DefaultSocket)
+
+	srv, err := Listen(path, sup)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	sup.StartAll()
+	t.Cleanup(func() {
+		sup.StopAll()
+		srv.Close()
+	})
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	return sup, client
+}
+
+// waitFor polls until cond is true or fails the test.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func running(sup *supervisor.Supervisor, name string) func() bool {
+	return func() bool {
+		info, err := sup.Status(name)
+		return err == nil && info.Status == "Running"
+	}
+}
+
+// TestServer_List returns every service with its state.
+func TestServer_List(t *testing.T) {
+	sup, client := serve(t,
+		config.ServiceConfig{Name: "a", Cmd: loop},
+		config.ServiceConfig{Name: "b", Cmd: loop},
+	)
+	waitFor(t, "a running", running(sup, "a"))
+
+	resp, err := client.Get("http://treehouse/services")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var infos []ServiceInfo
+	if err := json.NewDecoder(resp.Body).Decode(&infos); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(infos) != 2 || infos[0].Name != "a" || infos[1].Name != "b" {
+		t.Fatalf("expected services a and b, got %+v", infos)
+	}
+	if infos[0].Status != "Running" || infos[0].PID == 0 || infos[0].StartedAt == nil {
+		t.Errorf("expected a running with PID and start time, got %+v", infos[0])
+	}
+}
+
+// TestServer_Actions stops and restarts a service and reports errors as JSON.
+func TestServer_Actions(t *testing.T) {
+	sup, client := serve(t, config.ServiceConfig{Name: "a", Cmd: loop})
+	waitFor(t, "a running", running(sup, "a"))
+
+	post := func(path string) (int, map[string]any) {
+		t.Helper()
+		resp, err := client.Post("http://treehouse"+path, "application/json", nil)
+		if err != nil {
+			t.Fatalf("post %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		var body map[string]any
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	if code, body := post("/services/a/stop"); code != http.StatusOK || body["status"] != "Exited" {
+		t.Errorf("stop: expected 200 Exited, got %d %v", code, body)
+	}
+	if code, _ := post("/services/a/start"); code != http.StatusOK {
+		t.Errorf("start: expected 200, got %d", code)
+	}
+	waitFor(t, "a running", running(sup, "a"))
+
+	if code, body := post("/services/a/start"); code != http.StatusConflict || body["error"] == nil {
+		t.Errorf("start running: expected 409 with error, got %d %v", code, body)
+	}
+	if code, _ := post("/services/a/restart"); code != http.StatusOK {
+		t.Errorf("restart: expected 200, got %d", code)
+	}
+	if code, body := post("/services/nope/restart"); code != http.StatusNotFound || body["error"] == nil {
+		t.Errorf("unknown: expected 404 with error, got %d %v", code, body)
+	}
+}
+
+// TestServer_Logs returns buffered output and follows new lines.
+func TestServer_Logs(t *testing.T) {
+	sup, client := serve(t, config.ServiceConfig{Name: "a", Cmd: "echo one; echo two; sleep 0.3; echo three; " + loop})
+	waitFor(t, "buffered lines", func() bool {
+		lines, _ := sup.Logs("a")
+		return len(lines) >= 2
+	})
+
+	resp, err := client.Get("http://treehouse/services/a/logs?tail=1")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "two\n" {
+		t.Errorf("expected tail of one line, got %q", body)
+	}
+
+	resp, err = client.Get("http://treehouse/services/a/logs?follow=1")
+	if err != nil {
+		t.Fatalf("follow: %v", err)
+	}
+	defer resp.Body.Close()
+
+	found := make(chan bool, 1)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if strings.TrimSpace(scanner.Text()) == "three" {
+				found <- true
+				return
+			}
+		}
+		found <- false
+	}()
+	select {
+	case ok := <-found:
+		if !ok {
+			t.Error("stream ended before the followed line arrived")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out following logs")
+	}
+}
+
+// TestListen_SocketInUse refuses to replace a live socket but removes a stale one.
+func TestListen_SocketInUse(t *testing.T) {
+	sup := supervisor.New(supervisor.Options{})
+	path := filepath.Join(t.TempDir(), DefaultSocket)
+
+	srv, err := Listen(path, sup)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	if _, err := Listen(path, sup); !errors.Is(err, ErrInUse) {
+		t.Errorf("expected ErrInUse for socket in use, got %v", err)
+	}
+	srv.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected socket removed on close, got %v", err)
+	}
+
+	// A leftover socket file with no listener is replaced
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("stale listen: %v", err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	srv, err = Listen(path, sup)
+	if err != nil {
+		t.Fatalf("expected stale socket to be replaced, got %v", err)
+	}
+	srv.Close()
+}
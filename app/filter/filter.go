@@ -0,0 +1,70 @@
+package filter
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Filter decides whose output is shown from the --focus and --mute flags.
+// Each holds service names or glob patterns such as "worker-*", matched with
+// path.Match.
+type Filter struct {
+	// Focus, when not empty, shows only the services matching one of its
+	// patterns.
+	Focus []string
+	// Mute hides the services matching one of its patterns.
+	Mute []string
+}
+
+// New creates a filter from flag values, splitting comma-separated lists.
+func New(focus, mute []string) Filter {
+	return Filter{Focus: Split(focus), Mute: Split(mute)}
+}
+
+// Shown reports whether a service's output passes the filter.
+func (f Filter) Shown(name string) bool {
+	if len(f.Focus) > 0 && !Match(f.Focus, name) {
+		return false
+	}
+	return !Match(f.Mute, name)
+}
+
+// Validate returns an error for the first malformed pattern.
+func (f Filter) Validate() error {
+	for _, flag := range []struct {
+		name     string
+		patterns []string
+	}{{"focus", f.Focus}, {"mute", f.Mute}} {
+		for _, pattern := range flag.patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid --%s pattern %q: %w", flag.name, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Match reports whether name matches one of the patterns. Malformed patterns
+// match nothing.
+func Match(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Split splits comma-separated values into trimmed, non-empty patterns.
+func Split(values []string) []string {
+	var patterns []string
+	for _, value := range values {
+		for _, pattern := range strings.Split(value, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				patterns = append(patterns, pattern)
+			}
+		}
+	}
+	return patterns
+}
@@ -0,0 +1,43 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	got := Split([]string{"api, web", "", "worker-*,"})
+	want := []string{"api", "web", "worker-*"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestFilter_Shown(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		shown  map[string]bool
+	}{
+		{"empty", New(nil, nil), map[string]bool{"api": true, "worker-a": true}},
+		{"focus", New([]string{"api,web"}, nil), map[string]bool{"api": true, "web": true, "db": false}},
+		{"mute glob", New(nil, []string{"worker-*"}), map[string]bool{"api": true, "worker-a": false, "worker-b": false}},
+		{"focus and mute", New([]string{"worker-*"}, []string{"worker-b"}), map[string]bool{"api": false, "worker-a": true, "worker-b": false}},
+	}
+	for _, tt := range tests {
+		for name, want := range tt.shown {
+			if got := tt.filter.Shown(name); got != want {
+				t.Errorf("%s: Shown(%q) = %v, want %v", tt.name, name, got, want)
+			}
+		}
+	}
+}
+
+func TestFilter_Validate(t *testing.T) {
+	if err := New([]string{"api", "worker-*"}, []string{"db-[0-9]"}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := New(nil, []string{"db-["}).Validate(); err == nil {
+		t.Error("expected error for malformed pattern")
+	}
+}
@@ -0,0 +1,129 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/simiancreative/treehouse/app/config"
+)
+
+// DefaultCommandTimeout is the default timeout (in seconds) for a single
+// command health check attempt.
+const DefaultCommandTimeout = 5
+
+// Checker performs a single health check attempt. It reports whether the
+// service is healthy and a short detail of the outcome, such as the HTTP
+// status code.
+type Checker interface {
+	Check(ctx context.Context) (bool, string, error)
+}
+
+// NewChecker returns the checker for a health check entry: a command check
+// when a command is set, otherwise a TCP check when a tcp address is set,
+// otherwise an HTTP check. The command check runs with env in the service's
+// directory. HTTP checks with
+// insecure_skip_verify use their own client instead of client.
+func NewChecker(entry config.HealthEntry, client HTTPClient, env []string) Checker {
+	switch {
+	case entry.Command != "":
+		timeout := entry.CommandTimeoutSeconds
+		if timeout <= 0 {
+			timeout = DefaultCommandTimeout
+		}
+		return CommandChecker{
+			Command: entry.Command,
+			Env:     env,
+			Dir:     entry.Dir,
+			Timeout: time.Duration(timeout) * time.Second,
+		}
+	case entry.TCP != "":
+		return TCPChecker{Address: entry.TCP}
+	default:
+		if entry.InsecureSkipVerify {
+			client = insecureClient
+		}
+		return HTTPChecker{
+			Client:  client,
+			Method:  entry.Method,
+			URL:     entry.URL,
+			Headers: entry.Headers,
+			Body:    entry.Body,
+			Codes:   entry.Codes,
+			Expect:  entry.ExpectBody,
+		}
+	}
+}
+
+// TCPChecker checks that an address accepts connections. A connection attempt
+// ends after Timeout, if set, or when ctx is done.
+type TCPChecker struct {
+	Address string
+	Timeout time.Duration
+}
+
+func (c TCPChecker) Check(ctx context.Context) (bool, string, error) {
+	conn, err := (&net.Dialer{Timeout: c.Timeout}).DialContext(ctx, "tcp", c.Address)
+	if err != nil {
+		return false, c.Address, err
+	}
+	conn.Close()
+	return true, c.Address, nil
+}
+
+// CommandChecker runs a shell command and counts exit status 0 as healthy.
+type CommandChecker struct {
+	Command string
+	// Env is the full environment of the command.
+	Env []string
+	// Dir is the working directory of the command; empty means the current
+	// directory.
+	Dir     string
+	Timeout time.Duration
+}
+
+func (c CommandChecker) Check(ctx context.Context) (bool, string, error) {
+	ok, code, err := CheckCommand(ctx, c.Command, c.Env, c.Dir, c.Timeout)
+	if err != nil {
+		return false, "", err
+	}
+	return ok, fmt.Sprintf("exit %d", code), nil
+}
+
+// CheckCommand runs a shell command with the given environment in dir and
+// reports whether it exited with status 0, along with its exit code. The
+// command and any processes it started are killed when the timeout elapses or
+// ctx is canceled.
+func CheckCommand(ctx context.Context, command string, env []string, dir string, timeout time.Duration) (bool, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = env
+	cmd.Dir = dir
+	// run in its own process group so a timeout kills the whole command
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return false, -1, fmt.Errorf("command timed out after %s", timeout)
+	}
+	if ctx.Err() != nil {
+		return false, -1, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return false, exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return false, -1, err
+	}
+	return true, 0, nil
+}
@@ -0,0 +1,94 @@
+package health
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/simiancreative/treehouse/app/config"
+)
+
+func TestCheckCommand(t *testing.T) {
+	ctx := context.Background()
+
+	ok, code, err := CheckCommand(ctx, "exit 0", nil, "", time.Second)
+	if err != nil || !ok || code != 0 {
+		t.Errorf("exit 0: expected healthy, got ok=%v code=%d err=%v", ok, code, err)
+	}
+
+	ok, code, err = CheckCommand(ctx, "exit 3", nil, "", time.Second)
+	if err != nil || ok || code != 3 {
+		t.Errorf("exit 3: expected unhealthy with code 3, got ok=%v code=%d err=%v", ok, code, err)
+	}
+
+	ok, _, err = CheckCommand(ctx, `test "$READY" = yes`, []string{"READY=yes"}, "", time.Second)
+	if err != nil || !ok {
+		t.Errorf("env: expected healthy with inherited env, got ok=%v err=%v", ok, err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ready.sh"), []byte("exit 0\n"), 0644); err != nil {
+		t.Fatalf("writing script: %v", err)
+	}
+	ok, _, err = CheckCommand(ctx, "sh ./ready.sh", nil, dir, time.Second)
+	if err != nil || !ok {
+		t.Errorf("dir: expected relative script found in dir, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestCheckCommand_Timeout(t *testing.T) {
+	start := time.Now()
+	ok, _, err := CheckCommand(context.Background(), "sleep 5", nil, "", 100*time.Millisecond)
+	if err == nil || ok {
+		t.Errorf("expected timeout error, got ok=%v err=%v", ok, err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected command killed after timeout, took %s", elapsed)
+	}
+}
+
+func TestNewChecker(t *testing.T) {
+	tests := map[string]struct {
+		entry config.HealthEntry
+		want  Checker
+	}{
+		"http": {
+			entry: config.HealthEntry{URL: "http://localhost:3000", Codes: []int{200}},
+			want:  HTTPChecker{URL: "http://localhost:3000", Codes: []int{200}},
+		},
+		"tcp": {
+			entry: config.HealthEntry{TCP: "localhost:5432"},
+			want:  TCPChecker{Address: "localhost:5432"},
+		},
+		"command": {
+			entry: config.HealthEntry{Command: "pg_isready", CommandTimeoutSeconds: 3, Dir: "/srv/db"},
+			want:  CommandChecker{Command: "pg_isready", Env: []string{"A=1"}, Dir: "/srv/db", Timeout: 3 * time.Second},
+		},
+		"command default timeout": {
+			entry: config.HealthEntry{Command: "pg_isready"},
+			want:  CommandChecker{Command: "pg_isready", Env: []string{"A=1"}, Timeout: DefaultCommandTimeout * time.Second},
+		},
+	}
+
+	for name, tt := range tests {
+		got := NewChecker(tt.entry, nil, []string{"A=1"})
+		switch want := tt.want.(type) {
+		case HTTPChecker:
+			c, ok := got.(HTTPChecker)
+			if !ok || c.URL != want.URL || len(c.Codes) != len(want.Codes) {
+				t.Errorf("%s: expected %+v, got %+v", name, want, got)
+			}
+		case TCPChecker:
+			if got != want {
+				t.Errorf("%s: expected %+v, got %+v", name, want, got)
+			}
+		case CommandChecker:
+			c, ok := got.(CommandChecker)
+			if !ok || c.Command != want.Command || c.Dir != want.Dir || c.Timeout != want.Timeout || len(c.Env) != 1 {
+				t.Errorf("%s: expected %+v, got %+v", name, want, got)
+			}
+		}
+	}
+}
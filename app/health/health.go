@@ -4,27 +4,36 @@ import (
 	"net/http"
 )
 
-// HTTPClient defines the interface for making HTTP GET requests.
+// HTTPClient defines the interface for sending HTTP requests.
 type HTTPClient interface {
-	Get(url string) (*http.Response, error)
+	Do(req *http.Request) (*http.Response, error)
 }
 
 // CheckStatus performs a GET request to the given URL and checks if the response status code
 // is in the provided list of acceptable codes. It returns a boolean indicating success,
 // the actual status code, and any error encountered.
 func CheckStatus(client HTTPClient, url string, codes []int) (bool, int, error) {
-	resp, err := client.Get(url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return false, 0, err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return false, 0, err
 	}
 	defer resp.Body.Close()
 	code := resp.StatusCode
+	return codeAccepted(code, codes), code, nil
+}
+
+// codeAccepted reports whether code is one of the accepted codes.
+func codeAccepted(code int, codes []int) bool {
 	for _, c := range codes {
 		if c == code {
-			return true, code, nil
+			return true
 		}
 	}
-	return false, code, nil
+	return false
 }
 
 // DefaultHealthInterval is the default interval (in seconds) between health check attempts.
@@ -33,3 +42,10 @@ const DefaultHealthInterval = 2
 // DefaultHealthTimeout is the default timeout (in seconds) for health checks.
 const DefaultHealthTimeout = 30
 
+// DefaultFailureThreshold is the default number of consecutive liveness
+// failures before a service is marked unhealthy.
+const DefaultFailureThreshold = 3
+
+// DefaultSuccessThreshold is the default number of consecutive liveness
+// successes before an unhealthy service is marked healthy again.
+const DefaultSuccessThreshold = 1
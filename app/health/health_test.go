@@ -1,11 +1,14 @@
 package health
 
 import (
+	"context"
 	"errors"
 	"io"
+	"net"
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 )
 
 // fakeClient implements HTTPClient for testing.
@@ -14,8 +17,8 @@ type fakeClient struct {
 	err  error
 }
 
-// Get returns a preset response or error.
-func (f *fakeClient) Get(url string) (*http.Response, error) {
+// Do returns a preset response or error.
+func (f *fakeClient) Do(req *http.Request) (*http.Response, error) {
 	return f.resp, f.err
 }
 
@@ -62,3 +65,22 @@ func TestCheckStatus_Error(t *testing.T) {
 	}
 }
 
+func TestTCPChecker(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := l.Addr().String()
+
+	checker := TCPChecker{Address: addr, Timeout: time.Second}
+	ok, _, err := checker.Check(context.Background())
+	if err != nil || !ok {
+		t.Errorf("expected ok for listening port, got ok=%v err=%v", ok, err)
+	}
+
+	l.Close()
+	ok, _, err = checker.Check(context.Background())
+	if err == nil || ok {
+		t.Errorf("expected error for closed port, got ok=%v err=%v", ok, err)
+	}
+}
@@ -0,0 +1,32 @@
+package health
+
+// DefaultHistorySize is the default number of probe results kept per service.
+const DefaultHistorySize = 50
+
+// History keeps the most recent probe results, oldest first. It is not safe
+// for concurrent use.
+type History struct {
+	limit   int
+	results []Result
+}
+
+// NewHistory creates a history that keeps at most limit results.
+func NewHistory(limit int) *History {
+	if limit <= 0 {
+		limit = DefaultHistorySize
+	}
+	return &History{limit: limit}
+}
+
+// Add records a result, dropping the oldest one when the history is full.
+func (h *History) Add(res Result) {
+	h.results = append(h.results, res)
+	if over := len(h.results) - h.limit; over > 0 {
+		h.results = append(h.results[:0], h.results[over:]...)
+	}
+}
+
+// Results returns a copy of the recorded results, oldest first.
+func (h *History) Results() []Result {
+	return append([]Result(nil), h.results...)
+}
@@ -0,0 +1,20 @@
+package health
+
+import "testing"
+
+func TestHistory(t *testing.T) {
+	h := NewHistory(2)
+	h.Add(Result{Detail: "1"})
+	h.Add(Result{Detail: "2"})
+	h.Add(Result{Detail: "3"})
+
+	got := h.Results()
+	if len(got) != 2 || got[0].Detail != "2" || got[1].Detail != "3" {
+		t.Errorf("expected the two newest results, got %+v", got)
+	}
+
+	got[0].Detail = "changed"
+	if h.Results()[0].Detail != "2" {
+		t.Error("expected Results to return a copy")
+	}
+}
@@ -0,0 +1,155 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/simiancreative/treehouse/app/config"
+)
+
+// maxBodyBytes limits how much of a response body is read for assertions.
+const maxBodyBytes = 1 << 20
+
+// insecureClient is used for HTTP checks that skip TLS verification.
+var insecureClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	},
+}
+
+// HTTPChecker checks that a URL responds with one of the expected codes and,
+// if set, a body that satisfies Expect.
+type HTTPChecker struct {
+	Client HTTPClient
+	// Method defaults to GET.
+	Method  string
+	URL     string
+	Headers map[string]string
+	Body    string
+	Codes   []int
+	Expect  *config.BodyExpectation
+}
+
+// Check sends the request and reports the status code as detail. A response
+// with an accepted code whose body fails an assertion is unhealthy, with an
+// error describing the failed assertion.
+func (c HTTPChecker) Check(ctx context.Context) (bool, string, error) {
+	method := c.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if c.Body != "" {
+		body = strings.NewReader(c.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.URL, body)
+	if err != nil {
+		return false, "", err
+	}
+	for k, v := range c.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+
+	code := strconv.Itoa(resp.StatusCode)
+	if !codeAccepted(resp.StatusCode, c.Codes) {
+		return false, code, nil
+	}
+	if c.Expect == nil {
+		return true, code, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	if err != nil {
+		return false, code, fmt.Errorf("reading body: %w", err)
+	}
+	if err := CheckBody(data, *c.Expect); err != nil {
+		return false, code, err
+	}
+	return true, code, nil
+}
+
+// CheckBody returns an error describing the first assertion the body fails.
+func CheckBody(body []byte, expect config.BodyExpectation) error {
+	if expect.Contains != "" && !strings.Contains(string(body), expect.Contains) {
+		return fmt.Errorf("body does not contain %q", expect.Contains)
+	}
+
+	if expect.Regex != "" {
+		re, err := regexp.Compile(expect.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid body regex: %w", err)
+		}
+		if !re.Match(body) {
+			return fmt.Errorf("body does not match %q", expect.Regex)
+		}
+	}
+
+	if len(expect.JSON) == 0 {
+		return nil
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(body)))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return fmt.Errorf("body is not JSON: %w", err)
+	}
+	for path, want := range expect.JSON {
+		got, ok := jsonField(doc, path)
+		if !ok {
+			return fmt.Errorf("body field %s is missing", path)
+		}
+		if got != want {
+			return fmt.Errorf("body field %s is %q, expected %q", path, got, want)
+		}
+	}
+	return nil
+}
+
+// jsonField looks up a dotted path such as "checks.db" or "items.0.status"
+// and returns the field as text: strings as-is, other values as JSON.
+func jsonField(doc any, path string) (string, bool) {
+	v := doc
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			next, ok := node[key]
+			if !ok {
+				return "", false
+			}
+			v = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", false
+			}
+			v = node[i]
+		default:
+			return "", false
+		}
+	}
+
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+	text, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return string(text), true
+}
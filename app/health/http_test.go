@@ -0,0 +1,104 @@
+package health
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/simiancreative/treehouse/app/config"
+)
+
+func TestHTTPChecker_Request(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer token" || string(body) != `{"ping":true}` {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	checker := HTTPChecker{
+		Client:  srv.Client(),
+		Method:  http.MethodPost,
+		URL:     srv.URL,
+		Headers: map[string]string{"Authorization": "Bearer token"},
+		Body:    `{"ping":true}`,
+		Codes:   []int{201},
+	}
+	ok, detail, err := checker.Check(context.Background())
+	if err != nil || !ok || detail != "201" {
+		t.Errorf("expected healthy 201, got ok=%v detail=%s err=%v", ok, detail, err)
+	}
+}
+
+func TestHTTPChecker_BodyAssertion(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"ok","checks":{"db":"down"}}`))
+	}))
+	defer srv.Close()
+
+	checker := HTTPChecker{
+		Client: srv.Client(),
+		URL:    srv.URL,
+		Codes:  []int{200},
+		Expect: &config.BodyExpectation{JSON: map[string]string{"checks.db": "up"}},
+	}
+	ok, detail, err := checker.Check(context.Background())
+	if ok || detail != "200" || err == nil {
+		t.Errorf("expected unhealthy 200 with assertion error, got ok=%v detail=%s err=%v", ok, detail, err)
+	}
+
+	checker.Expect = &config.BodyExpectation{JSON: map[string]string{"status": "ok"}}
+	if ok, _, err := checker.Check(context.Background()); !ok || err != nil {
+		t.Errorf("expected healthy, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestHTTPChecker_InsecureSkipVerify(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	entry := config.HealthEntry{URL: srv.URL, Codes: []int{200}}
+	if ok, _, _ := NewChecker(entry, http.DefaultClient, nil).Check(context.Background()); ok {
+		t.Error("expected self-signed certificate to be rejected")
+	}
+
+	entry.InsecureSkipVerify = true
+	if ok, _, err := NewChecker(entry, http.DefaultClient, nil).Check(context.Background()); !ok || err != nil {
+		t.Errorf("expected healthy with insecure_skip_verify, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestCheckBody(t *testing.T) {
+	body := []byte(`{"status":"ok","count":3,"ready":true,"items":[{"name":"db"}]}`)
+
+	tests := map[string]struct {
+		expect  config.BodyExpectation
+		wantErr bool
+	}{
+		"contains":          {config.BodyExpectation{Contains: `"status":"ok"`}, false},
+		"contains missing":  {config.BodyExpectation{Contains: "down"}, true},
+		"regex":             {config.BodyExpectation{Regex: `"count":\d+`}, false},
+		"regex mismatch":    {config.BodyExpectation{Regex: `^ok$`}, true},
+		"json string":       {config.BodyExpectation{JSON: map[string]string{"status": "ok"}}, false},
+		"json number":       {config.BodyExpectation{JSON: map[string]string{"count": "3"}}, false},
+		"json bool":         {config.BodyExpectation{JSON: map[string]string{"ready": "true"}}, false},
+		"json array":        {config.BodyExpectation{JSON: map[string]string{"items.0.name": "db"}}, false},
+		"json mismatch":     {config.BodyExpectation{JSON: map[string]string{"status": "down"}}, true},
+		"json missing":      {config.BodyExpectation{JSON: map[string]string{"checks.db": "up"}}, true},
+		"json out of range": {config.BodyExpectation{JSON: map[string]string{"items.1.name": "db"}}, true},
+	}
+	for name, tt := range tests {
+		if err := CheckBody(body, tt.expect); (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", name, tt.wantErr, err)
+		}
+	}
+
+	if err := CheckBody([]byte("not json"), config.BodyExpectation{JSON: map[string]string{"a": "b"}}); err == nil {
+		t.Error("expected error for non-JSON body")
+	}
+}
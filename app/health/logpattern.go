@@ -0,0 +1,54 @@
+package health
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// LogMatcher watches a service's output for a line announcing that it is
+// ready, instead of polling it.
+type LogMatcher struct {
+	re      *regexp.Regexp
+	once    sync.Once
+	matched chan struct{}
+}
+
+// NewLogMatcher compiles the pattern matched against each output line.
+func NewLogMatcher(pattern string) (*LogMatcher, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &LogMatcher{re: re, matched: make(chan struct{})}, nil
+}
+
+// Observe checks a line of output against the pattern.
+func (m *LogMatcher) Observe(line string) {
+	if m.re.MatchString(line) {
+		m.once.Do(func() { close(m.matched) })
+	}
+}
+
+// Wait blocks until a line has matched, the timeout elapses or ctx is
+// canceled, and reports whether a line matched.
+func (m *LogMatcher) Wait(ctx context.Context, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-m.matched:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	// a match that raced with the timeout still counts
+	select {
+	case <-m.matched:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,46 @@
+package health
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLogMatcher(t *testing.T) {
+	m, err := NewLogMatcher(`Listening on :\d+`)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	go func() {
+		m.Observe("starting up")
+		m.Observe("Listening on :8233")
+		m.Observe("Listening on :8233")
+	}()
+	if !m.Wait(context.Background(), time.Second) {
+		t.Error("expected match")
+	}
+}
+
+func TestLogMatcher_Timeout(t *testing.T) {
+	m, err := NewLogMatcher(`ready`)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	m.Observe("starting up")
+	if m.Wait(context.Background(), 50*time.Millisecond) {
+		t.Error("expected no match before timeout")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if m.Wait(ctx, time.Second) {
+		t.Error("expected no match after cancel")
+	}
+}
+
+func TestNewLogMatcher_Invalid(t *testing.T) {
+	if _, err := NewLogMatcher("ready ("); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
@@ -0,0 +1,108 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/simiancreative/treehouse/app/config"
+)
+
+// Result is the outcome of a single probe attempt.
+type Result struct {
+	Time    time.Time
+	Latency time.Duration
+	OK      bool
+	// Detail describes the outcome, such as the HTTP status code.
+	Detail string
+	Err    error
+}
+
+// Prober runs a checker until it passes, the timeout elapses or its context
+// is canceled. Each attempt gets its own deadline, so a hung endpoint cannot
+// block the prober.
+type Prober struct {
+	Checker Checker
+	// Interval is the delay between attempts.
+	Interval time.Duration
+	// Timeout bounds the whole run.
+	Timeout time.Duration
+	// AttemptTimeout bounds a single attempt.
+	AttemptTimeout time.Duration
+	// OnResult, if set, is called after every attempt.
+	OnResult func(Result)
+}
+
+// NewProber creates a prober for a health check entry, using the given
+// defaults for an unset interval or timeout. An attempt may take up to the
+// interval, or the command timeout for command checks.
+func NewProber(entry config.HealthEntry, checker Checker, defaultInterval, defaultTimeout time.Duration) *Prober {
+	p := &Prober{
+		Checker:  checker,
+		Interval: defaultInterval,
+		Timeout:  defaultTimeout,
+	}
+	if entry.IntervalSeconds > 0 {
+		p.Interval = time.Duration(entry.IntervalSeconds) * time.Second
+	}
+	if entry.TimeoutSeconds > 0 {
+		p.Timeout = time.Duration(entry.TimeoutSeconds) * time.Second
+	}
+
+	p.AttemptTimeout = p.Interval
+	if entry.Command != "" {
+		timeout := entry.CommandTimeoutSeconds
+		if timeout <= 0 {
+			timeout = DefaultCommandTimeout
+		}
+		p.AttemptTimeout = time.Duration(timeout) * time.Second
+	}
+	return p
+}
+
+// Run probes until an attempt passes, the timeout elapses or ctx is canceled,
+// and returns the last result. Its OK field reports whether the check passed.
+func (p *Prober) Run(ctx context.Context) Result {
+	deadline := time.Now().Add(p.Timeout)
+	for {
+		res := p.Probe(ctx)
+		if res.OK || ctx.Err() != nil || !time.Now().Before(deadline) {
+			return res
+		}
+
+		timer := time.NewTimer(p.Interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return res
+		case <-timer.C:
+		}
+	}
+}
+
+// Probe runs a single attempt within the attempt timeout and reports its
+// result to OnResult.
+func (p *Prober) Probe(ctx context.Context) Result {
+	attemptCtx := ctx
+	if p.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, p.AttemptTimeout)
+		defer cancel()
+	}
+
+	res := Result{Time: time.Now()}
+	res.OK, res.Detail, res.Err = p.Checker.Check(attemptCtx)
+	res.Latency = time.Since(res.Time)
+	if res.Err != nil {
+		res.OK = false
+		if errors.Is(attemptCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			res.Err = fmt.Errorf("attempt timed out after %s", p.AttemptTimeout)
+		}
+	}
+
+	if p.OnResult != nil {
+		p.OnResult(res)
+	}
+	return res
+}
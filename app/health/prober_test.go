@@ -0,0 +1,98 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/simiancreative/treehouse/app/config"
+)
+
+// fakeChecker passes from the given attempt on; attempts start at 1.
+type fakeChecker struct {
+	attempts int
+	passFrom int
+}
+
+func (f *fakeChecker) Check(ctx context.Context) (bool, string, error) {
+	f.attempts++
+	if f.passFrom > 0 && f.attempts >= f.passFrom {
+		return true, "200", nil
+	}
+	return false, "", errors.New("connection refused")
+}
+
+// hungChecker blocks until its context is done, like an endpoint that never answers.
+type hungChecker struct{}
+
+func (hungChecker) Check(ctx context.Context) (bool, string, error) {
+	<-ctx.Done()
+	return false, "", ctx.Err()
+}
+
+func TestProber_Run(t *testing.T) {
+	checker := &fakeChecker{passFrom: 3}
+	var results []Result
+	p := &Prober{
+		Checker:  checker,
+		Interval: 10 * time.Millisecond,
+		Timeout:  time.Second,
+		OnResult: func(r Result) { results = append(results, r) },
+	}
+
+	res := p.Run(context.Background())
+	if !res.OK || res.Detail != "200" {
+		t.Errorf("expected passing result, got %+v", res)
+	}
+	if len(results) != 3 || results[0].OK || results[0].Err == nil || !results[2].OK {
+		t.Errorf("expected two failures then a pass, got %+v", results)
+	}
+}
+
+func TestProber_Timeout(t *testing.T) {
+	p := &Prober{Checker: &fakeChecker{}, Interval: 10 * time.Millisecond, Timeout: 50 * time.Millisecond}
+
+	res := p.Run(context.Background())
+	if res.OK || res.Err == nil {
+		t.Errorf("expected failing result with error, got %+v", res)
+	}
+}
+
+func TestProber_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Prober{Checker: hungChecker{}, Interval: time.Second, Timeout: time.Minute}
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if res := p.Run(ctx); res.OK {
+		t.Errorf("expected failing result, got %+v", res)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected run to stop on cancel, took %s", elapsed)
+	}
+}
+
+func TestProber_AttemptTimeout(t *testing.T) {
+	p := &Prober{Checker: hungChecker{}, AttemptTimeout: 20 * time.Millisecond}
+
+	res := p.Probe(context.Background())
+	if res.OK || res.Err == nil || res.Err.Error() != "attempt timed out after 20ms" {
+		t.Errorf("expected attempt timeout, got %+v", res)
+	}
+	if res.Latency < 20*time.Millisecond {
+		t.Errorf("expected latency of at least the attempt timeout, got %s", res.Latency)
+	}
+}
+
+func TestNewProber(t *testing.T) {
+	p := NewProber(config.HealthEntry{URL: "http://localhost"}, nil, 2*time.Second, 30*time.Second)
+	if p.Interval != 2*time.Second || p.Timeout != 30*time.Second || p.AttemptTimeout != 2*time.Second {
+		t.Errorf("expected defaults, got %+v", p)
+	}
+
+	p = NewProber(config.HealthEntry{Command: "true", IntervalSeconds: 1, TimeoutSeconds: 5, CommandTimeoutSeconds: 3}, nil, 2*time.Second, 30*time.Second)
+	if p.Interval != time.Second || p.Timeout != 5*time.Second || p.AttemptTimeout != 3*time.Second {
+		t.Errorf("expected entry settings, got %+v", p)
+	}
+}
@@ -2,16 +2,19 @@ package runner
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
-	"sync"
 	"time"
 
 	"github.com/simiancreative/treehouse/app/colors"
 	"github.com/simiancreative/treehouse/app/config"
+	"github.com/simiancreative/treehouse/app/control"
+	"github.com/simiancreative/treehouse/app/filter"
 	"github.com/simiancreative/treehouse/app/health"
 	"github.com/simiancreative/treehouse/app/service"
+	"github.com/simiancreative/treehouse/app/supervisor"
 
 	"github.com/charmbracelet/lipgloss"
 )
@@ -25,13 +28,22 @@ const (
 // Options configures a Runner.
 type Options struct {
 	ConfigDir             string
+	ConfigFiles           []string // config files to load instead of those in ConfigDir
 	Mode                  string
-	Focus, Mute           string
+	Focus, Mute           []string // service names or glob patterns, optionally comma-separated
 	Colors                []string
 	DefaultHealthInterval int
 	DefaultHealthTimeout  int
 	HTTPClient            health.HTTPClient
 	SPMMode               bool // When true, only run health checks for the focused service
+	// Services selects the services to run and their modes; nil runs all core services.
+	Services []config.Selection
+	// Socket is the path of the control API socket; empty disables the API.
+	Socket string
+	// DefaultSocket reports that Socket is the default path rather than one
+	// given with --socket. When another treehouse is using it, the run goes on
+	// without the API.
+	DefaultSocket bool
 }
 
 // Runner orchestrates services and health checks.
@@ -59,66 +71,135 @@ func New(opts Options) *Runner {
 // Run executes the environment setup, starts services, performs health checks, and waits.
 func (r *Runner) Run(ctx context.Context) error {
 	// Load the consolidated configuration
-	cfg, err := config.LoadConfig(r.opts.ConfigDir + "/treehouse.yaml")
+	cfg, err := config.Load(r.opts.ConfigDir, r.opts.ConfigFiles, r.opts.Mode)
 	if err != nil {
 		return fmt.Errorf("loading config: %w", err)
 	}
 
-	// Set environment variables
-	for k, v := range cfg.GlobalEnv {
-		os.Setenv(k, v)
+	// Resolve the selected services (all core services by default)
+	svcs, err := cfg.ResolveServices(r.opts.Services, r.opts.Mode)
+	if err != nil {
+		return fmt.Errorf("getting service config: %w", err)
 	}
 
-	// Convert core services to service configs
-	var svcs []config.ServiceConfig
-	for name, svc := range cfg.CoreServices {
-		serviceConfig, err := cfg.GetServiceConfig(name, r.opts.Mode)
-		if err != nil {
-			return fmt.Errorf("getting service config: %w", err)
+	healthChecks := make(map[string]config.HealthEntry)
+	colorMap := make(map[string]string, len(svcs))
+	for i, svc := range svcs {
+		colorMap[svc.Name] = r.opts.Colors[i%len(r.opts.Colors)]
+
+		// In SPM mode, only run health checks for the focused service
+		hc, err := cfg.GetHealthCheck(svc.Name, svc.Mode)
+		if err == nil && hc.Enabled() && (!r.opts.SPMMode || filter.Match(filter.Split(r.opts.Focus), svc.Name)) {
+			healthChecks[svc.Name] = *hc
 		}
-		svcs = append(svcs, *serviceConfig)
+	}
+
+	// Start services once their dependencies are ready, then perform health checks
+	sup := r.newSupervisor(svcs, healthChecks, colorMap)
 
-		// Set service-specific environment variables
-		for k, v := range svc.Env {
-			os.Setenv(k, v)
+	// Serve the control API so other processes can inspect and control the run
+	if r.opts.Socket != "" {
+		srv, err := control.Listen(r.opts.Socket, sup)
+		switch {
+		case err == nil:
+			defer srv.Close()
+		case r.opts.DefaultSocket && errors.Is(err, control.ErrInUse):
+			fmt.Fprintf(os.Stderr, "warning: %v, running without the control API\n", err)
+		default:
+			return err
 		}
 	}
 
-	// Start all services concurrently
-	var svcWg sync.WaitGroup
-	svcWg.Add(len(svcs))
-	for i, svc := range svcs {
-		color := r.opts.Colors[i%len(r.opts.Colors)]
-		go func(s config.ServiceConfig, color string) {
-			defer svcWg.Done()
-			r.startService(ctx, s, color)
-		}(svc, color)
+	sup.StartAll()
+
+	// Wait for all services to exit on their own, or stop them in reverse
+	// start order on cancellation
+	allDone := make(chan struct{})
+	go func() {
+		sup.Wait()
+		close(allDone)
+	}()
+	select {
+	case <-allDone:
+	case <-ctx.Done():
+		sup.StopAll()
+		<-allDone
 	}
 
-	// Perform health checks for services
-	var hcWg sync.WaitGroup
-	for i, svc := range svcs {
-		// In SPM mode, only run health checks for the focused service
-		if r.opts.SPMMode && svc.Name != r.opts.Focus {
-			continue
-		}
+	r.printHealthSummary(sup, svcs, healthChecks, colorMap)
+
+	return nil
+}
 
-		hc, err := cfg.GetHealthCheck(svc.Name)
-		if err != nil {
-			continue // Skip health check if not configured
+// newSupervisor creates a supervisor that prints service output and events
+// prefixed with the service name in its color.
+//   - Processes each output line with the focus/mute filters.
+//   - Prints a line before each restart, when a crash loop is detected and when stopping.
+//   - Runs health checks with startHealth each time a service starts, and
+//     prints the result of log pattern checks run by the supervisor.
+//   - Probes services with a liveness setting once they are healthy.
+//   - Records every health check attempt in the supervisor's history.
+func (r *Runner) newSupervisor(svcs []config.ServiceConfig, healthChecks map[string]config.HealthEntry, colorMap map[string]string) *supervisor.Supervisor {
+	handlers := make(map[string]func(string), len(svcs))
+	envs := make(map[string][]string, len(svcs))
+	for _, svc := range svcs {
+		handlers[svc.Name] = serviceTextHandler(svc, colorMap[svc.Name])
+		envs[svc.Name] = svc.Environ()
+	}
+
+	// health check results are recorded in the supervisor's history
+	var sup *supervisor.Supervisor
+	record := func(name string) func(health.Result) {
+		return func(res health.Result) {
+			sup.RecordProbe(name, res)
 		}
-		color := r.opts.Colors[i%len(r.opts.Colors)]
-		hcWg.Add(1)
-		go func(name string, entry config.HealthEntry, color string) {
-			defer hcWg.Done()
-			r.startHealth(ctx, name, entry, color)
-		}(svc.Name, *hc, color)
 	}
-	hcWg.Wait()
 
-	// Wait for all service processes to exit before returning
-	svcWg.Wait()
-	return nil
+	sup = supervisor.New(supervisor.Options{
+		Services:     svcs,
+		HealthChecks: healthChecks,
+		Filter:       filter.New(r.opts.Focus, r.opts.Mute),
+	}).
+		SetLogCallback(func(name, line string) {
+			handlers[name](line)
+		}).
+		SetStatusCallback(func(name, status string) {
+			switch status {
+			case service.Statuses["CrashLoop"]:
+				handlers[name]("crash loop detected")
+			case service.Statuses["Stopping"]:
+				handlers[name]("stopping")
+			case service.Statuses["Healthy"], service.Statuses["Unhealthy"]:
+				// log pattern checks are run by the supervisor, not startHealth
+				if hc := healthChecks[name]; hc.LogPattern != "" {
+					r.printLogPatternResult(name, status == service.Statuses["Healthy"], colorMap[name])
+				}
+			}
+		}).
+		SetRestartCallback(func(name string, attempt int, delay time.Duration) {
+			handlers[name](fmt.Sprintf("restarting in %s (restart %d)", delay, attempt))
+		}).
+		SetErrorCallback(func(name string, err error) {
+			fmt.Fprintf(os.Stderr, "Error for %s: %v\n", name, err)
+		}).
+		SetHealthCheck(func(ctx context.Context, name string, entry config.HealthEntry) bool {
+			return r.startHealth(ctx, name, r.newProber(entry, envs[name], record(name)), colorMap[name])
+		}).
+		SetLivenessProbe(func(ctx context.Context, name string, entry config.HealthEntry) bool {
+			return r.newProber(entry, envs[name], record(name)).Probe(ctx).OK
+		})
+	return sup
+}
+
+// printLogPatternResult prints the outcome of a log pattern health check in
+// the same format as startHealth.
+func (r *Runner) printLogPatternResult(svcName string, healthy bool, color string) {
+	style := lipgloss.NewStyle().Foreground(lipgloss.Color(color))
+	if healthy {
+		fmt.Printf("%s success (log pattern)\n", style.Render(fmt.Sprintf("[health][%s]", svcName)))
+		return
+	}
+	fmt.Printf("%s failure (timeout)\n", style.Render(fmt.Sprintf("[health][%s]", svcName)))
 }
 
 func serviceTextHandler(svc config.ServiceConfig, color string) func(string) {
@@ -130,66 +211,102 @@ func serviceTextHandler(svc config.ServiceConfig, color string) func(string) {
 	}
 }
 
-// startService starts a service process and streams its output.
-//   - Launches the command as a subprocess tied to the provided context (cancellable).
-//   - Attaches to both stdout and stderr pipes.
-//   - Processes each output line with service.ProcessStream (applying focus/mute filters).
-//   - Prints each line prefixed with the service name and colored output.
-//   - Waits for all output to be drained and the process to exit.
-func (r *Runner) startService(ctx context.Context, svc config.ServiceConfig, color string) {
-	textHandler := serviceTextHandler(svc, color)
-
-	err := service.
-		New().
-		SetConfig(svc).
-		SetStdOutCallback(textHandler).
-		SetStdErrCallback(textHandler).
-		SetFocus(r.opts.Focus).
-		SetMute(r.opts.Mute).
-		Start(ctx)
+// startHealth performs health checks for a service until success, timeout, or context done.
+//   - The prober repeatedly runs the checker for the entry (an HTTP status check,
+//     a TCP dial or a command run with the service's environment), each attempt
+//     within its own deadline.
+//   - On first successful check, prints a success message and returns true.
+//   - If the timeout duration elapses, prints a failure message and returns false.
+//   - If the context is canceled, prints an aborted message and returns false immediately.
+func (r *Runner) startHealth(ctx context.Context, svcName string, prober *health.Prober, color string) bool {
+	res := prober.Run(ctx)
 
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error for %s: %v\n", svc.Name, err)
+	// Prepare a lipgloss style for health messages
+	style := lipgloss.NewStyle().Foreground(lipgloss.Color(color))
+	prefix := style.Render(fmt.Sprintf("[health][%s]", svcName))
+	switch {
+	case res.OK:
+		fmt.Printf("%s success (%s)\n", prefix, res.Detail)
+		return true
+	case ctx.Err() != nil:
+		fmt.Printf("%s aborted\n", prefix)
+		return false
+	default:
+		fmt.Printf("%s failure (timeout)\n", prefix)
+		return false
 	}
 }
 
-// startHealth performs health checks for a service until success, timeout, or context done.
-//   - Reads or defaults the polling interval and timeout duration.
-//   - Repeatedly invokes health.CheckStatus against the configured URL and expected codes.
-//   - On first successful status, prints a success message and returns.
-//   - If the timeout duration elapses, prints a failure message and returns.
-//   - If the context is canceled, prints an aborted message and returns immediately.
-func (r *Runner) startHealth(ctx context.Context, svcName string, entry config.HealthEntry, color string) {
-	interval := entry.IntervalSeconds
-	if interval <= 0 {
-		interval = r.opts.DefaultHealthInterval
-	}
-	timeout := entry.TimeoutSeconds
-	if timeout <= 0 {
-		timeout = r.opts.DefaultHealthTimeout
-	}
-	start := time.Now()
-	// Prepare a lipgloss style for health messages
-	style := lipgloss.NewStyle().Foreground(lipgloss.Color(color))
-	for {
-		select {
-		case <-ctx.Done():
-			// Context canceled: abort health check
-			fmt.Printf("%s aborted\n", style.Render(fmt.Sprintf("[health][%s]", svcName)))
-			return
-		default:
+// newProber creates a prober for a health check with the runner's defaults
+// that reports each attempt to onResult.
+func (r *Runner) newProber(entry config.HealthEntry, env []string, onResult func(health.Result)) *health.Prober {
+	p := health.NewProber(
+		entry,
+		health.NewChecker(entry, r.opts.HTTPClient, env),
+		time.Duration(r.opts.DefaultHealthInterval)*time.Second,
+		time.Duration(r.opts.DefaultHealthTimeout)*time.Second,
+	)
+	p.OnResult = onResult
+	return p
+}
+
+// printHealthSummary prints the health check history of each service with a
+// health check once all services have exited.
+func (r *Runner) printHealthSummary(sup *supervisor.Supervisor, svcs []config.ServiceConfig, healthChecks map[string]config.HealthEntry, colorMap map[string]string) {
+	for _, svc := range svcs {
+		if _, ok := healthChecks[svc.Name]; !ok {
+			continue
+		}
+		results, err := sup.HealthHistory(svc.Name)
+		if err != nil || len(results) == 0 {
+			continue
 		}
-		ok, code, err := health.CheckStatus(r.opts.HTTPClient, entry.URL, entry.Codes)
-		if err == nil && ok {
-			// Success
-			fmt.Printf("%s success (%d)\n", style.Render(fmt.Sprintf("[health][%s]", svcName)), code)
-			return
+
+		style := lipgloss.NewStyle().Foreground(lipgloss.Color(colorMap[svc.Name]))
+		failed := 0
+		for _, res := range results {
+			if !res.OK {
+				failed++
+			}
 		}
-		if time.Since(start) > time.Duration(timeout)*time.Second {
-			// Timeout
-			fmt.Printf("%s failure (timeout)\n", style.Render(fmt.Sprintf("[health][%s]", svcName)))
-			return
+		fmt.Printf("%s %d checks, %d failed\n", style.Render(fmt.Sprintf("[health][%s]", svc.Name)), len(results), failed)
+		for _, line := range summarizeProbes(results) {
+			fmt.Println("  " + line)
 		}
-		time.Sleep(time.Duration(interval) * time.Second)
+	}
+}
+
+// summarizeProbes groups consecutive probe results with the same outcome, so
+// that a service refusing connections for 30 seconds shows as one line:
+//
+//	15:04:01  15x error: dial tcp [::1]:3000: connect: connection refused (avg 1ms)
+func summarizeProbes(results []health.Result) []string {
+	var lines []string
+	for i := 0; i < len(results); {
+		outcome := probeOutcome(results[i])
+		j := i
+		var total time.Duration
+		for j < len(results) && probeOutcome(results[j]) == outcome {
+			total += results[j].Latency
+			j++
+		}
+		avg := (total / time.Duration(j-i)).Round(time.Millisecond)
+		lines = append(lines, fmt.Sprintf("%s  %dx %s (avg %s)", results[i].Time.Format("15:04:05"), j-i, outcome, avg))
+		i = j
+	}
+	return lines
+}
+
+// probeOutcome describes a probe result without its timing.
+func probeOutcome(res health.Result) string {
+	switch {
+	case res.Err != nil && res.Detail != "":
+		return fmt.Sprintf("error: %s: %v", res.Detail, res.Err)
+	case res.Err != nil:
+		return fmt.Sprintf("error: %v", res.Err)
+	case res.OK:
+		return "ok " + res.Detail
+	default:
+		return "failed " + res.Detail
 	}
 }
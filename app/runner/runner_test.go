@@ -3,10 +3,16 @@ package runner
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/simiancreative/treehouse/app/health"
 )
 
 // captureStderr redirects os.Stderr for the duration of f and returns the captured output.
@@ -26,13 +32,15 @@ func captureStderr(f func()) string {
 	return buf.String()
 }
 
-// TestRun_Success verifies that a valid configuration runs successfully.
+// TestRun_Success verifies that a valid configuration runs successfully and
+// that each service gets its own environment without leaking into the process.
 func TestRun_Success(t *testing.T) {
 	dir := t.TempDir()
+	out := filepath.Join(dir, "env.out")
 	// Create a minimal treehouse.yaml
 	config := `core_services:
   svc:
-    command: "true"
+    command: "echo $FOO-$BAZ > ` + out + `"
     env:
       FOO: "bar"
       BAZ: "qux"
@@ -55,12 +63,86 @@ func TestRun_Success(t *testing.T) {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
-	// Verify environment variables were set
-	if got := os.Getenv("FOO"); got != "bar" {
-		t.Errorf("FOO: expected 'bar', got %q", got)
+	// Verify the service saw its environment variables
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("reading service output: %v", err)
+	}
+	if string(got) != "bar-qux\n" {
+		t.Errorf("service env: expected 'bar-qux', got %q", got)
+	}
+
+	// Verify environment variables were not set on the process
+	if got := os.Getenv("FOO"); got != "" {
+		t.Errorf("FOO: expected unset, got %q", got)
+	}
+	if got := os.Getenv("BAZ"); got != "" {
+		t.Errorf("BAZ: expected unset, got %q", got)
+	}
+}
+
+// TestRun_DefaultSocketInUse verifies that a run goes on without the control
+// API when another treehouse holds the default socket, but fails when the
+// socket was given explicitly.
+func TestRun_DefaultSocketInUse(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "treehouse.yaml"), []byte("core_services:\n  svc:\n    command: \"true\"\n"), 0644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+	socket := filepath.Join(dir, ".treehouse.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+
+	var runErr error
+	stderr := captureStderr(func() {
+		runErr = New(Options{ConfigDir: dir, Socket: socket, DefaultSocket: true}).Run(context.Background())
+	})
+	if runErr != nil {
+		t.Fatalf("expected the run to go on without the API, got %v", runErr)
+	}
+	if !strings.Contains(stderr, "running without the control API") {
+		t.Errorf("expected a warning, got %q", stderr)
+	}
+
+	err = New(Options{ConfigDir: dir, Socket: socket}).Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "in use by another treehouse") {
+		t.Errorf("expected socket in use error, got %v", err)
+	}
+}
+
+// TestRun_EnvIsolation verifies that services with the same variable each see their own value.
+func TestRun_EnvIsolation(t *testing.T) {
+	dir := t.TempDir()
+	config := `core_services:
+  one:
+    command: "echo $PORT > ` + filepath.Join(dir, "one.out") + `"
+    env:
+      PORT: "3000"
+  two:
+    command: "echo $PORT > ` + filepath.Join(dir, "two.out") + `"
+    env:
+      PORT: "3001"
+`
+	if err := os.WriteFile(filepath.Join(dir, "treehouse.yaml"), []byte(config), 0644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	r := New(Options{ConfigDir: dir, Mode: "test"})
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
 	}
-	if got := os.Getenv("BAZ"); got != "qux" {
-		t.Errorf("BAZ: expected 'qux', got %q", got)
+
+	for name, want := range map[string]string{"one": "3000\n", "two": "3001\n"} {
+		got, err := os.ReadFile(filepath.Join(dir, name+".out"))
+		if err != nil {
+			t.Fatalf("reading %s output: %v", name, err)
+		}
+		if string(got) != want {
+			t.Errorf("%s PORT: expected %q, got %q", name, want, got)
+		}
 	}
 }
 
@@ -109,3 +191,169 @@ func TestRun_ModeOverride(t *testing.T) {
 		t.Fatalf("expected no error, got %v", err)
 	}
 }
+
+// TestRun_DependencyCycle verifies that a dependency cycle aborts Run with an error.
+func TestRun_DependencyCycle(t *testing.T) {
+	dir := t.TempDir()
+	config := `core_services:
+  a:
+    command: "true"
+    depends_on: [b]
+  b:
+    command: "true"
+    depends_on: [a]
+`
+	if err := os.WriteFile(filepath.Join(dir, "treehouse.yaml"), []byte(config), 0644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	r := New(Options{ConfigDir: dir, Mode: "test"})
+	if err := r.Run(context.Background()); err == nil {
+		t.Fatal("expected error for dependency cycle, got nil")
+	}
+}
+
+// TestRun_StopsInReverseOrder verifies that services are stopped in reverse start order on cancellation.
+func TestRun_StopsInReverseOrder(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "stopped.out")
+	loop := "while true; do sleep 0.05; done"
+	config := `core_services:
+  db:
+    command: "trap 'echo db >> ` + out + `; exit 0' TERM; ` + loop + `"
+  api:
+    command: "trap 'echo api >> ` + out + `; exit 0' TERM; ` + loop + `"
+    depends_on: [db]
+`
+	if err := os.WriteFile(filepath.Join(dir, "treehouse.yaml"), []byte(config), 0644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(500*time.Millisecond, cancel)
+
+	r := New(Options{ConfigDir: dir, Mode: "test"})
+	if err := r.Run(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("reading stop order: %v", err)
+	}
+	if string(got) != "api\ndb\n" {
+		t.Errorf("stop order: expected api then db, got %q", got)
+	}
+}
+
+// TestRun_TCPHealthCheck verifies that a tcp health check gates dependents on
+// the port accepting connections.
+func TestRun_TCPHealthCheck(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	closed.Close()
+
+	for name, tc := range map[string]struct {
+		addr    string
+		started bool
+	}{
+		"listening": {addr: l.Addr().String(), started: true},
+		"closed":    {addr: closed.Addr().String(), started: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			out := filepath.Join(dir, "api.out")
+			config := `core_services:
+  db:
+    command: "sleep 1.5"
+    health_check:
+      tcp: "` + tc.addr + `"
+      interval_seconds: 1
+      timeout_seconds: 1
+  api:
+    command: "echo started > ` + out + `"
+    depends_on:
+      - service: db
+        condition: healthy
+`
+			if err := os.WriteFile(filepath.Join(dir, "treehouse.yaml"), []byte(config), 0644); err != nil {
+				t.Fatalf("writing config: %v", err)
+			}
+
+			r := New(Options{ConfigDir: dir, Mode: "test"})
+			captureStderr(func() {
+				if err := r.Run(context.Background()); err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+			})
+
+			_, err := os.Stat(out)
+			if started := err == nil; started != tc.started {
+				t.Errorf("api started: expected %v, got %v", tc.started, started)
+			}
+		})
+	}
+}
+
+// TestRun_CommandHealthCheck verifies that a command health check runs with
+// the service's environment and gates dependents on its exit status.
+func TestRun_CommandHealthCheck(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "api.out")
+	config := `core_services:
+  db:
+    command: "sleep 0.5"
+    env:
+      DB_READY: "yes"
+    health_check:
+      command: 'test "$DB_READY" = yes'
+      interval_seconds: 1
+      timeout_seconds: 1
+  api:
+    command: "echo started > ` + out + `"
+    depends_on:
+      - service: db
+        condition: healthy
+`
+	if err := os.WriteFile(filepath.Join(dir, "treehouse.yaml"), []byte(config), 0644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	r := New(Options{ConfigDir: dir, Mode: "test"})
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := os.Stat(out); err != nil {
+		t.Errorf("expected api to start after db became healthy: %v", err)
+	}
+}
+
+// TestSummarizeProbes groups consecutive probe results with the same outcome.
+func TestSummarizeProbes(t *testing.T) {
+	start := time.Date(2024, 1, 1, 15, 4, 0, 0, time.UTC)
+	refused := errors.New("connection refused")
+	results := []health.Result{
+		{Time: start, Latency: time.Millisecond, Err: refused},
+		{Time: start.Add(2 * time.Second), Latency: 3 * time.Millisecond, Err: refused},
+		{Time: start.Add(4 * time.Second), Latency: 5 * time.Millisecond, Detail: "500"},
+		{Time: start.Add(6 * time.Second), Latency: 4 * time.Millisecond, OK: true, Detail: "200"},
+	}
+
+	got := summarizeProbes(results)
+	want := []string{
+		"15:04:00  2x error: connection refused (avg 2ms)",
+		"15:04:04  1x failed 500 (avg 5ms)",
+		"15:04:06  1x ok 200 (avg 4ms)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
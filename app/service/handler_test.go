@@ -2,7 +2,11 @@ package service
 
 import (
 	"context"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/simiancreative/treehouse/app/config"
 )
@@ -69,3 +73,240 @@ func TestStart_Failure(t *testing.T) {
 	}
 }
 
+// TestStart_Env verifies that the service environment overrides the inherited one.
+func TestStart_Env(t *testing.T) {
+	t.Setenv("TREEHOUSE_INHERITED", "parent")
+	t.Setenv("TREEHOUSE_OVERRIDE", "parent")
+	var outLines []string
+	h := New().
+		SetConfig(config.ServiceConfig{
+			Name: "svc",
+			Cmd:  "echo $TREEHOUSE_INHERITED $TREEHOUSE_OVERRIDE",
+			Env:  map[string]string{"TREEHOUSE_OVERRIDE": "service"},
+		}).
+		SetStdOutCallback(func(line string) { outLines = append(outLines, line) })
+	if err := h.Start(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(outLines) != 1 || outLines[0] != "parent service" {
+		t.Errorf("unexpected output: %v", outLines)
+	}
+}
+
+// TestStart_Dir verifies that the command runs in the service's directory.
+func TestStart_Dir(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("resolving temp dir: %v", err)
+	}
+	var outLines []string
+	h := New().
+		SetConfig(config.ServiceConfig{Name: "svc", Cmd: "pwd -P", Dir: dir}).
+		SetStdOutCallback(func(line string) { outLines = append(outLines, line) })
+	if err := h.Start(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(outLines) != 1 || outLines[0] != dir {
+		t.Errorf("expected output %q, got %v", dir, outLines)
+	}
+}
+
+// TestStart_RestartOnFailure verifies that a failing command is restarted up to max retries.
+func TestStart_RestartOnFailure(t *testing.T) {
+	var statuses []string
+	var attempts []int
+	h := New().
+		SetConfig(config.ServiceConfig{
+			Name: "svc",
+			Cmd:  "exit 1",
+			Restart: config.RestartConfig{
+				Policy:             config.RestartOnFailure,
+				MaxRetries:         2,
+				Backoff:            time.Millisecond,
+				MaxBackoff:         time.Millisecond,
+				CrashLoopThreshold: 10,
+				CrashLoopWindow:    time.Minute,
+			},
+		}).
+		SetStatusCallback(func(s string) { statuses = append(statuses, s) }).
+		SetRestartCallback(func(attempt int, delay time.Duration) { attempts = append(attempts, attempt) })
+	if err := h.Start(context.Background()); err == nil {
+		t.Fatal("expected error after retries are exhausted, got nil")
+	}
+	if len(attempts) != 2 || attempts[0] != 1 || attempts[1] != 2 {
+		t.Errorf("expected restart attempts [1 2], got %v", attempts)
+	}
+	want := []string{
+		"Starting", "Running", "Crashed", "Restarting",
+		"Starting", "Running", "Crashed", "Restarting",
+		"Starting", "Running", "Crashed",
+	}
+	if strings.Join(statuses, ",") != strings.Join(want, ",") {
+		t.Errorf("expected statuses %v, got %v", want, statuses)
+	}
+}
+
+// TestStart_StopDuringBackoff verifies that stopping a service while it waits
+// to restart is a clean exit, not the previous run's failure.
+func TestStart_StopDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var statuses []string
+	h := New().
+		SetConfig(config.ServiceConfig{
+			Name:    "svc",
+			Cmd:     "exit 1",
+			Restart: config.RestartConfig{Policy: config.RestartOnFailure, Backoff: 5 * time.Second, MaxBackoff: 5 * time.Second},
+		}).
+		SetStatusCallback(func(s string) { statuses = append(statuses, s) }).
+		SetRestartCallback(func(int, time.Duration) { cancel() })
+	if err := h.Start(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := []string{"Starting", "Running", "Crashed", "Restarting", "Exited"}
+	if strings.Join(statuses, ",") != strings.Join(want, ",") {
+		t.Errorf("expected statuses %v, got %v", want, statuses)
+	}
+}
+
+// TestStart_RestartOnFailureCleanExit verifies that a clean exit is not restarted on-failure.
+func TestStart_RestartOnFailureCleanExit(t *testing.T) {
+	restarted := false
+	h := New().
+		SetConfig(config.ServiceConfig{
+			Name:    "svc",
+			Cmd:     "true",
+			Restart: config.RestartConfig{Policy: config.RestartOnFailure, Backoff: time.Millisecond},
+		}).
+		SetRestartCallback(func(int, time.Duration) { restarted = true })
+	if err := h.Start(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if restarted {
+		t.Error("expected no restart after a clean exit")
+	}
+}
+
+// TestStart_CrashLoop verifies that repeated exits within the window report CrashLoop.
+func TestStart_CrashLoop(t *testing.T) {
+	var statuses []string
+	h := New().
+		SetConfig(config.ServiceConfig{
+			Name: "svc",
+			Cmd:  "true",
+			Restart: config.RestartConfig{
+				Policy:             config.RestartAlways,
+				MaxRetries:         3,
+				Backoff:            time.Millisecond,
+				MaxBackoff:         time.Millisecond,
+				CrashLoopThreshold: 2,
+				CrashLoopWindow:    time.Minute,
+			},
+		}).
+		SetStatusCallback(func(s string) { statuses = append(statuses, s) })
+	if err := h.Start(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var restarting, crashLoop int
+	for _, s := range statuses {
+		switch s {
+		case "Restarting":
+			restarting++
+		case "CrashLoop":
+			crashLoop++
+		}
+	}
+	if restarting != 1 || crashLoop != 2 {
+		t.Errorf("expected 1 Restarting and 2 CrashLoop, got %v", statuses)
+	}
+}
+
+// TestStart_RestartCanceled verifies that cancellation stops a pending restart.
+func TestStart_RestartCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := New().
+		SetConfig(config.ServiceConfig{
+			Name:    "svc",
+			Cmd:     "exit 1",
+			Restart: config.RestartConfig{Policy: config.RestartAlways, Backoff: time.Hour, MaxBackoff: time.Hour},
+		}).
+		SetRestartCallback(func(int, time.Duration) { cancel() })
+	done := make(chan error, 1)
+	go func() { done <- h.Start(ctx) }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Start to return after cancellation")
+	}
+}
+
+// TestRestartBackoff verifies exponential backoff capped at the maximum.
+func TestRestartBackoff(t *testing.T) {
+	policy := config.RestartConfig{
+		Backoff:            time.Second,
+		MaxBackoff:         5 * time.Second,
+		CrashLoopThreshold: 10,
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := restartBackoff(policy, i+1); got != w {
+			t.Errorf("exits=%d: expected %s, got %s", i+1, w, got)
+		}
+	}
+	if got := restartBackoff(policy, 10); got != policy.MaxBackoff {
+		t.Errorf("crash loop: expected %s, got %s", policy.MaxBackoff, got)
+	}
+}
+
+// TestStart_GracefulStop verifies that cancellation sends the stop signal and reports Stopping.
+func TestStart_GracefulStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var statuses []string
+	var outLines []string
+	h := New().
+		SetConfig(config.ServiceConfig{
+			Name:        "svc",
+			Cmd:         "trap 'echo got-int; exit 0' INT; echo ready; while true; do sleep 0.05; done",
+			StopSignal:  syscall.SIGINT,
+			StopTimeout: 5 * time.Second,
+		}).
+		SetStdOutCallback(func(line string) {
+			outLines = append(outLines, line)
+			if line == "ready" {
+				cancel()
+			}
+		}).
+		SetStatusCallback(func(s string) { statuses = append(statuses, s) })
+	if err := h.Start(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(outLines) != 2 || outLines[1] != "got-int" {
+		t.Errorf("expected the stop signal to be trapped, got %v", outLines)
+	}
+	want := []string{"Starting", "Running", "Stopping", "Exited"}
+	if strings.Join(statuses, ",") != strings.Join(want, ",") {
+		t.Errorf("expected statuses %v, got %v", want, statuses)
+	}
+}
+
+// TestStart_StopTimeout verifies that a process ignoring the stop signal is killed after the timeout.
+func TestStart_StopTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := New().
+		SetConfig(config.ServiceConfig{
+			Name:        "svc",
+			Cmd:         "trap '' TERM; echo ready; while true; do sleep 0.05; done",
+			StopTimeout: 100 * time.Millisecond,
+		}).
+		SetStdOutCallback(func(line string) {
+			if line == "ready" {
+				cancel()
+			}
+		})
+	done := make(chan error, 1)
+	go func() { done <- h.Start(ctx) }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the process to be killed after the stop timeout")
+	}
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/simiancreative/treehouse/app/config"
+)
+
+// readinessState records how far a tracked service has come.
+type readinessState struct {
+	healthCheck bool
+	started     bool
+	healthy     bool
+	// last is the latest process status, kept until the service stops for
+	// good.
+	last string
+	// failure is the status that ended the service before it became ready.
+	failure string
+}
+
+// Readiness tracks the lifecycle of a set of services so that dependents can
+// wait for their dependencies to be started or healthy.
+type Readiness struct {
+	mu      sync.Mutex
+	states  map[string]*readinessState
+	changed chan struct{}
+}
+
+func NewReadiness() *Readiness {
+	return &Readiness{
+		states:  make(map[string]*readinessState),
+		changed: make(chan struct{}),
+	}
+}
+
+// Track registers a service. A service without a health check counts as
+// healthy as soon as it is started.
+func (r *Readiness) Track(name string, healthCheck bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.states[name] = &readinessState{healthCheck: healthCheck}
+}
+
+// Reset forgets how far a service had come, for a new run of its command.
+// Its health check has to pass again before dependents waiting for it to be
+// healthy continue.
+func (r *Readiness) Reset(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if st, ok := r.states[name]; ok {
+		*st = readinessState{healthCheck: st.healthCheck}
+	}
+}
+
+// Update records a status reported for a service and wakes any waiters.
+func (r *Readiness) Update(name, status string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st, ok := r.states[name]
+	if !ok {
+		return
+	}
+
+	switch status {
+	case Statuses["Running"]:
+		st.started = true
+		st.failure = ""
+	case Statuses["Healthy"]:
+		st.started = true
+		st.healthy = true
+		st.failure = ""
+	case Statuses["Unhealthy"]:
+		st.failure = status
+	case Statuses["Crashed"], Statuses["Exited"], Statuses["Error"]:
+		// the restart policy may bring the service back; it has only failed
+		// once Finish is called
+		st.last = status
+		return
+	default:
+		return
+	}
+
+	r.notify()
+}
+
+// Finish records that a service has stopped for good and will not be
+// restarted. Dependents still waiting for it fail with its last status.
+func (r *Readiness) Finish(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st, ok := r.states[name]
+	if !ok {
+		return
+	}
+	st.failure = st.last
+	if st.failure == "" {
+		st.failure = Statuses["Exited"]
+	}
+	r.notify()
+}
+
+// notify wakes every waiter; r.mu must be held.
+func (r *Readiness) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// Wait blocks until every tracked dependency has reached its condition. It
+// returns an error if a dependency fails first or the context is canceled.
+// Dependencies that are not tracked are not waited on.
+func (r *Readiness) Wait(ctx context.Context, deps []config.Dependency) error {
+	for {
+		r.mu.Lock()
+		ready := true
+		var err error
+		for _, dep := range deps {
+			st, ok := r.states[dep.Service]
+			if !ok {
+				continue
+			}
+			if st.ready(dep.Condition) {
+				continue
+			}
+			if st.failure != "" {
+				err = fmt.Errorf("dependency %s is %s before becoming %s", dep.Service, st.failure, dep.Condition)
+				break
+			}
+			ready = false
+		}
+		changed := r.changed
+		r.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// ready reports whether the state satisfies a depends_on condition.
+func (st *readinessState) ready(condition string) bool {
+	if condition == config.ConditionHealthy && st.healthCheck {
+		return st.healthy
+	}
+	return st.started
+}
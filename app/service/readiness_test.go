@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simiancreative/treehouse/app/config"
+)
+
+// waitAsync runs Wait in a goroutine and returns a channel with its result.
+func waitAsync(r *Readiness, ctx context.Context, deps []config.Dependency) chan error {
+	done := make(chan error, 1)
+	go func() { done <- r.Wait(ctx, deps) }()
+	return done
+}
+
+// TestReadiness_Started waits until the dependency is running.
+func TestReadiness_Started(t *testing.T) {
+	r := NewReadiness()
+	r.Track("db", true)
+	done := waitAsync(r, context.Background(), []config.Dependency{{Service: "db", Condition: config.ConditionStarted}})
+
+	select {
+	case err := <-done:
+		t.Fatalf("expected Wait to block, returned %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	r.Update("db", "Running")
+	if err := <-done; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+// TestReadiness_Healthy waits for a health check to pass, not just the process start.
+func TestReadiness_Healthy(t *testing.T) {
+	r := NewReadiness()
+	r.Track("db", true)
+	done := waitAsync(r, context.Background(), []config.Dependency{{Service: "db", Condition: config.ConditionHealthy}})
+
+	r.Update("db", "Running")
+	select {
+	case err := <-done:
+		t.Fatalf("expected Wait to block until healthy, returned %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	r.Update("db", "Healthy")
+	if err := <-done; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+// TestReadiness_HealthyWithoutCheck treats a started service without a health check as healthy.
+func TestReadiness_HealthyWithoutCheck(t *testing.T) {
+	r := NewReadiness()
+	r.Track("db", false)
+	r.Update("db", "Running")
+	err := r.Wait(context.Background(), []config.Dependency{{Service: "db", Condition: config.ConditionHealthy}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+// TestReadiness_Failure returns an error when the dependency fails first.
+func TestReadiness_Failure(t *testing.T) {
+	r := NewReadiness()
+	r.Track("db", true)
+	done := waitAsync(r, context.Background(), []config.Dependency{{Service: "db", Condition: config.ConditionHealthy}})
+
+	r.Update("db", "Running")
+	r.Update("db", "Unhealthy")
+	if err := <-done; err == nil {
+		t.Fatal("expected error for unhealthy dependency")
+	}
+}
+
+// TestReadiness_CrashBeforeFinish keeps waiting through a crash the restart
+// policy may recover from, and fails once the service has stopped for good.
+func TestReadiness_CrashBeforeFinish(t *testing.T) {
+	r := NewReadiness()
+	r.Track("db", true)
+	done := waitAsync(r, context.Background(), []config.Dependency{{Service: "db", Condition: config.ConditionHealthy}})
+
+	r.Update("db", "Running")
+	r.Update("db", "Crashed")
+	r.Update("db", "Restarting")
+	select {
+	case err := <-done:
+		t.Fatalf("expected Wait to block while db may restart, returned %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	r.Finish("db")
+	err := <-done
+	if err == nil || !strings.Contains(err.Error(), "Crashed") {
+		t.Fatalf("expected error naming the crash, got %v", err)
+	}
+}
+
+// TestReadiness_Untracked does not wait on services outside the run.
+func TestReadiness_Untracked(t *testing.T) {
+	r := NewReadiness()
+	err := r.Wait(context.Background(), []config.Dependency{{Service: "other", Condition: config.ConditionStarted}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+// TestReadiness_Canceled stops waiting when the context is canceled.
+func TestReadiness_Canceled(t *testing.T) {
+	r := NewReadiness()
+	r.Track("db", false)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := waitAsync(r, ctx, []config.Dependency{{Service: "db", Condition: config.ConditionStarted}})
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+// TestReadiness_Reset requires a restarted service to pass its health check again.
+func TestReadiness_Reset(t *testing.T) {
+	r := NewReadiness()
+	r.Track("db", true)
+	r.Update("db", "Healthy")
+	r.Update("db", "Crashed")
+	r.Reset("db")
+
+	done := waitAsync(r, context.Background(), []config.Dependency{{Service: "db", Condition: config.ConditionHealthy}})
+	r.Update("db", "Running")
+	select {
+	case err := <-done:
+		t.Fatalf("expected Wait to block until healthy again, returned %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	r.Update("db", "Healthy")
+	if err := <-done; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
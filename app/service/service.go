@@ -6,9 +6,12 @@ import (
 	"io"
 	"os/exec"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/simiancreative/treehouse/app/config"
+	"github.com/simiancreative/treehouse/app/filter"
 
 	"github.com/pkg/errors"
 )
@@ -22,10 +25,14 @@ var Statuses = map[string]string{
 	"Error":      "Error",
 	"Crashed":    "Crashed",
 	"Exited":     "Exited",
+	"CrashLoop":  "CrashLoop",
 	"Healthy":    "Healthy",
 	"Unhealthy":  "Unhealthy",
 }
 
+// defaultStopTimeout is used when a service has no stop timeout configured.
+const defaultStopTimeout = 10 * time.Second
+
 func New() *Handler {
 	return &Handler{}
 }
@@ -33,12 +40,14 @@ func New() *Handler {
 type Handler struct {
 	svc config.ServiceConfig
 
-	focus string
-	mute  string
+	filter filter.Filter
+
+	stdoutCB  func(string)
+	stderrCB  func(string)
+	statusCB  func(string)
+	restartCB func(attempt int, delay time.Duration)
 
-	stdoutCB func(string)
-	stderrCB func(string)
-	statusCB func(string)
+	pid atomic.Int64
 }
 
 func (h *Handler) SetConfig(svc config.ServiceConfig) *Handler {
@@ -56,13 +65,17 @@ func (h *Handler) SetStdErrCallback(cb func(string)) *Handler {
 	return h
 }
 
-func (h *Handler) SetFocus(focus string) *Handler {
-	h.focus = focus
+// SetFocus limits the output passed to the callbacks to services matching
+// one of the names or glob patterns.
+func (h *Handler) SetFocus(focus ...string) *Handler {
+	h.filter.Focus = filter.Split(focus)
 	return h
 }
 
-func (h *Handler) SetMute(mute string) *Handler {
-	h.mute = mute
+// SetMute drops the output of services matching one of the names or glob
+// patterns.
+func (h *Handler) SetMute(mute ...string) *Handler {
+	h.filter.Mute = filter.Split(mute)
 	return h
 }
 
@@ -71,6 +84,18 @@ func (h *Handler) SetStatusCallback(cb func(string)) *Handler {
 	return h
 }
 
+// SetRestartCallback sets a callback invoked before each restart with the
+// restart attempt number and the backoff delay.
+func (h *Handler) SetRestartCallback(cb func(attempt int, delay time.Duration)) *Handler {
+	h.restartCB = cb
+	return h
+}
+
+// PID returns the process ID of the running command, or 0 when it is not running.
+func (h *Handler) PID() int {
+	return int(h.pid.Load())
+}
+
 func (h *Handler) sendStatus(status string) {
 	if h.statusCB == nil {
 		return
@@ -79,10 +104,97 @@ func (h *Handler) sendStatus(status string) {
 	h.statusCB(status)
 }
 
+// Start runs the service command and restarts it according to its restart
+// policy until it stops for good or the context is canceled. It returns the
+// error from the last run, or nil when it was stopped by canceling ctx.
 func (h *Handler) Start(ctx context.Context) error {
+	policy := h.svc.Restart
+	var exits []time.Time
+	restarts := 0
+
+	for {
+		err := h.run(ctx)
+		if ctx.Err() != nil || !h.shouldRestart(err) {
+			return err
+		}
+		if policy.MaxRetries > 0 && restarts >= policy.MaxRetries {
+			return err
+		}
+
+		// keep only the exits within the crash-loop window
+		now := time.Now()
+		recent := exits[:0]
+		for _, t := range exits {
+			if now.Sub(t) < policy.CrashLoopWindow {
+				recent = append(recent, t)
+			}
+		}
+		exits = append(recent, now)
+
+		delay := restartBackoff(policy, len(exits))
+		if policy.CrashLoopThreshold > 0 && len(exits) >= policy.CrashLoopThreshold {
+			h.sendStatus("CrashLoop")
+		} else {
+			h.sendStatus("Restarting")
+		}
+
+		restarts++
+		if h.restartCB != nil {
+			h.restartCB(restarts, delay)
+		}
+
+		select {
+		case <-ctx.Done():
+			// stopped on request while waiting to restart
+			h.sendStatus("Exited")
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// shouldRestart reports whether the restart policy applies to a run that
+// ended with err.
+func (h *Handler) shouldRestart(err error) bool {
+	switch h.svc.Restart.Policy {
+	case config.RestartAlways:
+		return true
+	case config.RestartOnFailure:
+		return err != nil
+	default:
+		return false
+	}
+}
+
+// restartBackoff doubles the base backoff for every recent exit, capped at
+// the maximum. A crash-looping service always waits the maximum.
+func restartBackoff(policy config.RestartConfig, recentExits int) time.Duration {
+	if policy.CrashLoopThreshold > 0 && recentExits >= policy.CrashLoopThreshold {
+		return policy.MaxBackoff
+	}
+	delay := policy.Backoff
+	for i := 1; i < recentExits && delay < policy.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > policy.MaxBackoff {
+		delay = policy.MaxBackoff
+	}
+	return delay
+}
+
+// run starts the command once and waits for it to exit. When the context is
+// canceled the process group is sent the stop signal and killed if it has not
+// exited within the stop timeout.
+func (h *Handler) run(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	h.sendStatus("Starting")
-	cmd := exec.CommandContext(ctx, "sh", "-c", h.svc.Cmd)
-	// set process group ID so we can kill the entire process group on cancel
+	cmd := exec.Command("sh", "-c", h.svc.Cmd)
+	cmd.Env = h.svc.Environ()
+	cmd.Dir = h.svc.Dir
+	// set process group ID so we can signal the entire process group on cancel
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
 	stdout, err := cmd.StdoutPipe()
@@ -102,24 +214,38 @@ func (h *Handler) Start(ctx context.Context) error {
 		return errors.Wrap(err, "failed to start command")
 	}
 
+	h.pid.Store(int64(cmd.Process.Pid))
 	h.sendStatus("Running")
-	// kill the process group on context cancellation
+	// stop the process group on context cancellation
+	exited := make(chan struct{})
+	stopped := make(chan struct{})
 	go func() {
-		<-ctx.Done()
-		if cmd.Process != nil {
-			if pgid, err := syscall.Getpgid(cmd.Process.Pid); err == nil {
-				syscall.Kill(-pgid, syscall.SIGKILL)
-			} else {
-				_ = cmd.Process.Kill()
-			}
+		defer close(stopped)
+		select {
+		case <-exited:
+			return
+		case <-ctx.Done():
 		}
+		h.sendStatus("Stopping")
+		h.stop(cmd, exited)
 	}()
 
 	if err := h.processStreams(stdout, stderr); err != nil {
 		return errors.Wrap(err, "failed to process streams")
 	}
 
-	if err := cmd.Wait(); err != nil {
+	err = cmd.Wait()
+	h.pid.Store(0)
+	close(exited)
+	<-stopped
+
+	if ctx.Err() != nil {
+		// stopped on request; the exit status is the signal we sent
+		h.sendStatus("Exited")
+		return nil
+	}
+
+	if err != nil {
 		h.sendStatus("Crashed")
 		return errors.Wrap(err, "command exited with error")
 	}
@@ -129,6 +255,39 @@ func (h *Handler) Start(ctx context.Context) error {
 	return nil
 }
 
+// stop sends the stop signal to the process group and escalates to SIGKILL
+// if the process has not exited within the stop timeout.
+func (h *Handler) stop(cmd *exec.Cmd, exited <-chan struct{}) {
+	sig := h.svc.StopSignal
+	if sig == 0 {
+		sig = syscall.SIGTERM
+	}
+	timeout := h.svc.StopTimeout
+	if timeout <= 0 {
+		timeout = defaultStopTimeout
+	}
+
+	signalGroup(cmd, sig)
+	select {
+	case <-exited:
+	case <-time.After(timeout):
+		signalGroup(cmd, syscall.SIGKILL)
+	}
+}
+
+// signalGroup sends a signal to the command's process group, falling back to
+// the process itself.
+func signalGroup(cmd *exec.Cmd, sig syscall.Signal) {
+	if cmd.Process == nil {
+		return
+	}
+	if pgid, err := syscall.Getpgid(cmd.Process.Pid); err == nil {
+		_ = syscall.Kill(-pgid, sig)
+	} else {
+		_ = cmd.Process.Signal(sig)
+	}
+}
+
 func (h *Handler) processStreams(stdout, stderr io.Reader) error {
 	var outWg sync.WaitGroup
 	outWg.Add(2)
@@ -155,10 +314,7 @@ func (h *Handler) processStream(r io.Reader, handleLine func(string)) {
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		text := scanner.Text()
-		if h.focus != "" && h.focus != h.svc.Name {
-			continue
-		}
-		if h.mute != "" && h.mute == h.svc.Name {
+		if !h.filter.Shown(h.svc.Name) {
 			continue
 		}
 
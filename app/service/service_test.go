@@ -51,3 +51,21 @@ func TestProcessStream_MuteFiltering(t *testing.T) {
 		t.Errorf("expected 0 lines for mute match, got %d", len(lines))
 	}
 }
+
+func TestProcessStream_PatternFiltering(t *testing.T) {
+	var lines []string
+	ProcessStream(strings.NewReader("a\n"), "worker-1", "api,worker-*", "", func(line string) {
+		lines = append(lines, line)
+	})
+	if len(lines) != 1 {
+		t.Errorf("expected 1 line for focus pattern match, got %d", len(lines))
+	}
+
+	lines = nil
+	ProcessStream(strings.NewReader("a\n"), "worker-1", "", "api,worker-*", func(line string) {
+		lines = append(lines, line)
+	})
+	if len(lines) != 0 {
+		t.Errorf("expected 0 lines for mute pattern match, got %d", len(lines))
+	}
+}
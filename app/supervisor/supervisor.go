@@ -0,0 +1,659 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/simiancreative/treehouse/app/config"
+	"github.com/simiancreative/treehouse/app/filter"
+	"github.com/simiancreative/treehouse/app/health"
+	"github.com/simiancreative/treehouse/app/service"
+)
+
+// ErrUnknownService is returned for a service name the supervisor does not own.
+var ErrUnknownService = errors.New("unknown service")
+
+// ErrAlreadyRunning is returned when starting a service that is running.
+var ErrAlreadyRunning = errors.New("already running")
+
+// Info describes the current state of a supervised service.
+type Info struct {
+	Name string
+	Mode string
+	// Status is the latest process status, one of service.Statuses.
+	Status string
+	// Health is the latest health check result ("Healthy" or "Unhealthy"),
+	// empty until a check has completed.
+	Health    string
+	PID       int
+	StartedAt time.Time
+	Restarts  int
+	// Active reports whether the service is running or waiting to start.
+	Active bool
+}
+
+// Options configures a Supervisor.
+type Options struct {
+	// Services are started in this order and stopped in reverse.
+	Services []config.ServiceConfig
+	// HealthChecks holds the health check for each service that has one.
+	HealthChecks map[string]config.HealthEntry
+	// Filter selects the services whose lines are passed to the log
+	// callback; every line is still kept in the service's log buffer.
+	Filter filter.Filter
+	// LogLines is the number of lines kept per service (default 1000).
+	LogLines int
+	// HealthHistory is the number of health check results kept per service
+	// (default health.DefaultHistorySize).
+	HealthHistory int
+}
+
+// defaultLogLines is the default number of buffered log lines per service.
+const defaultLogLines = 1000
+
+// subscriberBuffer is the number of lines queued for a slow log subscriber
+// before lines are dropped.
+const subscriberBuffer = 256
+
+// HealthFunc checks a service until it is healthy, times out, or ctx is
+// canceled, and reports whether it became healthy.
+type HealthFunc func(ctx context.Context, name string, entry config.HealthEntry) bool
+
+// ProbeFunc runs a single health check attempt and reports whether it passed.
+type ProbeFunc func(ctx context.Context, name string, entry config.HealthEntry) bool
+
+type entry struct {
+	svc  config.ServiceConfig
+	info Info
+
+	handler *service.Handler
+	cancel  context.CancelFunc
+	// done is closed when the current run exits; nil if never started.
+	done chan struct{}
+
+	logs        []string
+	subscribers map[int]chan string
+	probes      *health.History
+}
+
+func (e *entry) running() bool {
+	if e.done == nil {
+		return false
+	}
+	select {
+	case <-e.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Supervisor owns a service.Handler per service, each with its own context,
+// so services can be started, stopped and restarted individually.
+type Supervisor struct {
+	opts Options
+
+	mu        sync.Mutex
+	idle      *sync.Cond
+	active    int
+	entries   map[string]*entry
+	readiness *service.Readiness
+	nextSub   int
+
+	logCB     func(name, line string)
+	statusCB  func(name, status string)
+	restartCB func(name string, attempt int, delay time.Duration)
+	errorCB   func(name string, err error)
+	healthFn  HealthFunc
+	probeFn   ProbeFunc
+	probeCB   func(name string, res health.Result)
+}
+
+func New(opts Options) *Supervisor {
+	if opts.LogLines <= 0 {
+		opts.LogLines = defaultLogLines
+	}
+	s := &Supervisor{
+		opts:      opts,
+		entries:   make(map[string]*entry, len(opts.Services)),
+		readiness: service.NewReadiness(),
+	}
+	s.idle = sync.NewCond(&s.mu)
+
+	for _, svc := range opts.Services {
+		s.entries[svc.Name] = &entry{
+			svc: svc,
+			info: Info{
+				Name:   svc.Name,
+				Mode:   svc.Mode,
+				Status: service.Statuses["Pending"],
+			},
+			subscribers: make(map[int]chan string),
+			probes:      health.NewHistory(opts.HealthHistory),
+		}
+		_, hasHealth := opts.HealthChecks[svc.Name]
+		s.readiness.Track(svc.Name, hasHealth)
+	}
+
+	return s
+}
+
+// SetLogCallback sets the callback for every stdout and stderr line.
+func (s *Supervisor) SetLogCallback(cb func(name, line string)) *Supervisor {
+	s.logCB = cb
+	return s
+}
+
+// SetStatusCallback sets the callback for process status and health changes.
+func (s *Supervisor) SetStatusCallback(cb func(name, status string)) *Supervisor {
+	s.statusCB = cb
+	return s
+}
+
+// SetRestartCallback sets the callback invoked before a service is restarted
+// by its restart policy.
+func (s *Supervisor) SetRestartCallback(cb func(name string, attempt int, delay time.Duration)) *Supervisor {
+	s.restartCB = cb
+	return s
+}
+
+// SetErrorCallback sets the callback for a run that ends with an error.
+func (s *Supervisor) SetErrorCallback(cb func(name string, err error)) *Supervisor {
+	s.errorCB = cb
+	return s
+}
+
+// SetHealthCheck sets the function that runs a service's health check each
+// time the service starts.
+func (s *Supervisor) SetHealthCheck(fn HealthFunc) *Supervisor {
+	s.healthFn = fn
+	return s
+}
+
+// SetProbeCallback sets the callback for every health check result recorded
+// with RecordProbe.
+func (s *Supervisor) SetProbeCallback(cb func(name string, res health.Result)) *Supervisor {
+	s.probeCB = cb
+	return s
+}
+
+// SetLivenessProbe sets the function that runs single health check attempts
+// for liveness monitoring once a service with a liveness setting is healthy.
+func (s *Supervisor) SetLivenessProbe(fn ProbeFunc) *Supervisor {
+	s.probeFn = fn
+	return s
+}
+
+// StartAll starts every service that is not running, in start order. Each
+// service waits for its dependencies before its command runs.
+func (s *Supervisor) StartAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, svc := range s.opts.Services {
+		if e := s.entries[svc.Name]; !e.running() {
+			s.start(e)
+		}
+	}
+}
+
+// StopAll stops every service in reverse start order, waiting for each one
+// to exit before stopping the next.
+func (s *Supervisor) StopAll() {
+	for i := len(s.opts.Services) - 1; i >= 0; i-- {
+		_ = s.Stop(s.opts.Services[i].Name)
+	}
+}
+
+// Start starts a stopped service. It returns once the service is scheduled;
+// status changes are reported through the status callback.
+func (s *Supervisor) Start(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownService, name)
+	}
+	if e.running() {
+		return fmt.Errorf("service %s is %w", name, ErrAlreadyRunning)
+	}
+
+	s.start(e)
+	return nil
+}
+
+// Stop stops a service and waits for it to exit. Stopping a service that is
+// not running is a no-op.
+func (s *Supervisor) Stop(name string) error {
+	s.mu.Lock()
+	e, ok := s.entries[name]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownService, name)
+	}
+	cancel, done := e.cancel, e.done
+	s.mu.Unlock()
+
+	if done == nil {
+		return nil
+	}
+	cancel()
+	<-done
+	return nil
+}
+
+// Restart stops a service if it is running and starts it again.
+func (s *Supervisor) Restart(name string) error {
+	if err := s.Stop(name); err != nil {
+		return err
+	}
+	return s.Start(name)
+}
+
+// RestartAll stops every service in reverse start order and starts them all
+// again in start order.
+func (s *Supervisor) RestartAll() {
+	s.StopAll()
+	s.StartAll()
+}
+
+// Status returns the current state of a service.
+func (s *Supervisor) Status(name string) (Info, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return Info{}, fmt.Errorf("%w: %s", ErrUnknownService, name)
+	}
+	return s.snapshot(e), nil
+}
+
+// List returns the state of every service in start order.
+func (s *Supervisor) List() []Info {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	infos := make([]Info, 0, len(s.opts.Services))
+	for _, svc := range s.opts.Services {
+		infos = append(infos, s.snapshot(s.entries[svc.Name]))
+	}
+	return infos
+}
+
+// Logs returns the buffered output of a service, oldest line first.
+func (s *Supervisor) Logs(name string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownService, name)
+	}
+	return append([]string(nil), e.logs...), nil
+}
+
+// Subscribe returns the buffered output of a service and a channel that
+// receives every line written after it. The returned func ends the
+// subscription. Lines are dropped if the subscriber falls too far behind.
+func (s *Supervisor) Subscribe(name string) ([]string, <-chan string, func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("%w: %s", ErrUnknownService, name)
+	}
+
+	id := s.nextSub
+	s.nextSub++
+	ch := make(chan string, subscriberBuffer)
+	e.subscribers[id] = ch
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			delete(e.subscribers, id)
+		})
+	}
+	return append([]string(nil), e.logs...), ch, unsubscribe, nil
+}
+
+// RecordProbe adds the result of a health check attempt to a service's
+// history. Health funcs call it for each attempt they make.
+func (s *Supervisor) RecordProbe(name string, res health.Result) {
+	s.mu.Lock()
+	e, ok := s.entries[name]
+	if ok {
+		e.probes.Add(res)
+	}
+	s.mu.Unlock()
+
+	if ok && s.probeCB != nil {
+		s.probeCB(name, res)
+	}
+}
+
+// HealthHistory returns the recent health check results of a service, oldest
+// first.
+func (s *Supervisor) HealthHistory(name string) ([]health.Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownService, name)
+	}
+	return e.probes.Results(), nil
+}
+
+// Wait blocks until no service is running.
+func (s *Supervisor) Wait() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.active > 0 {
+		s.idle.Wait()
+	}
+}
+
+// snapshot copies the info of an entry; s.mu must be held.
+func (s *Supervisor) snapshot(e *entry) Info {
+	info := e.info
+	info.Active = e.running()
+	if e.handler != nil {
+		info.PID = e.handler.PID()
+	}
+	return info
+}
+
+// start launches a run of the service; s.mu must be held.
+func (s *Supervisor) start(e *entry) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	e.cancel, e.done = cancel, done
+	e.handler = nil
+	e.info.Status = service.Statuses["Pending"]
+	e.info.Health = ""
+	e.info.StartedAt = time.Time{}
+	e.info.Restarts = 0
+
+	_, hasHealth := s.opts.HealthChecks[e.svc.Name]
+	s.readiness.Track(e.svc.Name, hasHealth)
+
+	s.active++
+	go func() {
+		defer cancel()
+		s.run(ctx, e, done)
+	}()
+}
+
+// run waits for the service's dependencies and runs its command, with a health
+// check for every run, until it exits for good or ctx is canceled.
+func (s *Supervisor) run(ctx context.Context, e *entry, done chan struct{}) {
+	name := e.svc.Name
+	defer func() {
+		s.mu.Lock()
+		s.active--
+		s.idle.Broadcast()
+		s.mu.Unlock()
+		close(done)
+	}()
+
+	if err := s.readiness.Wait(ctx, e.svc.DependsOn); err != nil {
+		if ctx.Err() == nil {
+			s.setStatus(name, service.Statuses["Error"])
+			s.readiness.Finish(name)
+			s.reportError(name, fmt.Errorf("not started: %w", err))
+		}
+		return
+	}
+
+	// each run of the command, including those started by the restart
+	// policy, gets a fresh health check. It is armed when the run starts, so a
+	// log pattern matcher sees the first line, and canceled when the next run
+	// starts or this one ends.
+	hc, hasHealth := s.opts.HealthChecks[name]
+	var matcher atomic.Pointer[health.LogMatcher]
+	hcCancel := context.CancelFunc(func() {})
+	defer func() { hcCancel() }()
+
+	logLine := func(line string) {
+		if m := matcher.Load(); m != nil {
+			m.Observe(line)
+		}
+		s.writeLog(name, line)
+	}
+
+	handler := service.
+		New().
+		SetConfig(e.svc).
+		SetStdOutCallback(logLine).
+		SetStdErrCallback(logLine).
+		SetStatusCallback(func(status string) {
+			if hasHealth && status == service.Statuses["Starting"] {
+				hcCancel()
+				var m *health.LogMatcher
+				m, hcCancel = s.checkHealth(ctx, name, hc)
+				matcher.Store(m)
+			}
+			s.setStatus(name, status)
+		}).
+		SetRestartCallback(func(attempt int, delay time.Duration) {
+			s.mu.Lock()
+			e.info.Restarts = attempt
+			s.mu.Unlock()
+			if s.restartCB != nil {
+				s.restartCB(name, attempt, delay)
+			}
+		})
+
+	s.mu.Lock()
+	e.handler = handler
+	s.mu.Unlock()
+
+	err := handler.Start(ctx)
+	// the restart policy has given up or the service was stopped
+	s.readiness.Finish(name)
+	if err != nil {
+		s.reportError(name, err)
+	}
+}
+
+// checkHealth clears the health of a service and starts its health check in
+// the background, followed by liveness monitoring once it is healthy. A log
+// pattern check watches the output through the returned matcher; other checks
+// are run by the health func. The returned func cancels the check.
+func (s *Supervisor) checkHealth(ctx context.Context, name string, hc config.HealthEntry) (*health.LogMatcher, context.CancelFunc) {
+	s.mu.Lock()
+	s.entries[name].info.Health = ""
+	s.mu.Unlock()
+	s.readiness.Reset(name)
+
+	hcCtx, hcCancel := context.WithCancel(ctx)
+
+	var matcher *health.LogMatcher
+	check := func() bool { return s.healthFn(hcCtx, name, hc) }
+	if hc.LogPattern != "" {
+		var err error
+		if matcher, err = health.NewLogMatcher(hc.LogPattern); err != nil {
+			s.reportError(name, fmt.Errorf("invalid log_pattern: %w", err))
+			return nil, hcCancel
+		}
+		check = func() bool {
+			res := health.Result{Time: time.Now(), Detail: "log pattern"}
+			res.OK = matcher.Wait(hcCtx, logPatternTimeout(hc))
+			res.Latency = time.Since(res.Time)
+			if !res.OK {
+				res.Err = fmt.Errorf("no line matched %q", hc.LogPattern)
+			}
+			if hcCtx.Err() == nil {
+				s.RecordProbe(name, res)
+			}
+			return res.OK
+		}
+	} else if s.healthFn == nil {
+		return nil, hcCancel
+	}
+
+	go func() {
+		healthy := check()
+		if hcCtx.Err() != nil {
+			return
+		}
+		s.setHealth(name, healthy)
+		if healthy && hc.Liveness != nil && hc.LogPattern == "" && s.probeFn != nil {
+			s.monitor(hcCtx, name, hc)
+		}
+	}()
+	return matcher, hcCancel
+}
+
+// monitor probes a healthy service every liveness interval until ctx is
+// canceled. It marks the service Unhealthy after FailureThreshold consecutive
+// failures and Healthy again after SuccessThreshold consecutive successes,
+// and restarts it after RestartAfter consecutive failures.
+func (s *Supervisor) monitor(ctx context.Context, name string, hc config.HealthEntry) {
+	live := *hc.Liveness
+	interval := live.IntervalSeconds
+	if interval <= 0 {
+		interval = hc.IntervalSeconds
+	}
+	if interval <= 0 {
+		interval = health.DefaultHealthInterval
+	}
+	if live.FailureThreshold <= 0 {
+		live.FailureThreshold = health.DefaultFailureThreshold
+	}
+	if live.SuccessThreshold <= 0 {
+		live.SuccessThreshold = health.DefaultSuccessThreshold
+	}
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	healthy := true
+	failures, successes := 0, 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ok := s.probeFn(ctx, name, hc)
+		if ctx.Err() != nil {
+			return
+		}
+		if ok {
+			failures = 0
+			successes++
+		} else {
+			successes = 0
+			failures++
+		}
+
+		switch {
+		case healthy && failures >= live.FailureThreshold:
+			healthy = false
+			s.writeLog(name, fmt.Sprintf("liveness check failed %d times in a row", failures))
+			s.setHealth(name, false)
+		case !healthy && successes >= live.SuccessThreshold:
+			healthy = true
+			s.writeLog(name, "liveness check recovered")
+			s.setHealth(name, true)
+		}
+
+		if live.RestartAfter > 0 && failures >= live.RestartAfter {
+			s.writeLog(name, fmt.Sprintf("restarting after %d failed liveness checks", failures))
+			// Restart cancels ctx, ending this monitor
+			if err := s.Restart(name); err != nil {
+				s.reportError(name, err)
+			}
+			return
+		}
+	}
+}
+
+// writeLog buffers a line of a service's log, either its own output or a
+// supervisor message, and passes it to the log callback.
+func (s *Supervisor) writeLog(name, line string) {
+	s.appendLog(name, line)
+	if s.logCB != nil && s.opts.Filter.Shown(name) {
+		s.logCB(name, line)
+	}
+}
+
+// logPatternTimeout returns how long to wait for a log pattern to match.
+func logPatternTimeout(hc config.HealthEntry) time.Duration {
+	timeout := hc.TimeoutSeconds
+	if timeout <= 0 {
+		timeout = health.DefaultHealthTimeout
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// setStatus records a process status and forwards it to the status callback.
+func (s *Supervisor) setStatus(name, status string) {
+	s.mu.Lock()
+	e := s.entries[name]
+	e.info.Status = status
+	if status == service.Statuses["Running"] {
+		e.info.StartedAt = time.Now()
+	}
+	s.mu.Unlock()
+
+	s.readiness.Update(name, status)
+	if s.statusCB != nil {
+		s.statusCB(name, status)
+	}
+}
+
+// setHealth records a health check result and forwards it to the status callback.
+func (s *Supervisor) setHealth(name string, healthy bool) {
+	status := service.Statuses["Unhealthy"]
+	if healthy {
+		status = service.Statuses["Healthy"]
+	}
+
+	s.mu.Lock()
+	s.entries[name].info.Health = status
+	s.mu.Unlock()
+
+	s.readiness.Update(name, status)
+	if s.statusCB != nil {
+		s.statusCB(name, status)
+	}
+}
+
+// appendLog buffers a line and passes it to the service's subscribers.
+func (s *Supervisor) appendLog(name, line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.entries[name]
+	e.logs = append(e.logs, line)
+	if over := len(e.logs) - s.opts.LogLines; over > 0 {
+		e.logs = append(e.logs[:0], e.logs[over:]...)
+	}
+	for _, ch := range e.subscribers {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+func (s *Supervisor) reportError(name string, err error) {
+	if s.errorCB != nil {
+		s.errorCB(name, err)
+	}
+}
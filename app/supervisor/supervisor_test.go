@@ -0,0 +1,532 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/simiancreative/treehouse/app/config"
+	"github.com/simiancreative/treehouse/app/filter"
+	"github.com/simiancreative/treehouse/app/health"
+)
+
+const loop = "while true; do sleep 0.05; done"
+
+// recorder collects status callbacks.
+type recorder struct {
+	mu       sync.Mutex
+	statuses map[string][]string
+	order    []string
+}
+
+func (r *recorder) status(name, status string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.statuses == nil {
+		r.statuses = make(map[string][]string)
+	}
+	r.statuses[name] = append(r.statuses[name], status)
+	r.order = append(r.order, name+":"+status)
+}
+
+// waitFor polls until cond is true or fails the test.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func statusIs(s *Supervisor, name, status string) func() bool {
+	return func() bool {
+		info, err := s.Status(name)
+		return err == nil && info.Status == status
+	}
+}
+
+// TestSupervisor_StartStopRestart controls a single service without touching the others.
+func TestSupervisor_StartStopRestart(t *testing.T) {
+	s := New(Options{Services: []config.ServiceConfig{
+		{Name: "a", Cmd: loop},
+		{Name: "b", Cmd: loop},
+	}})
+	s.StartAll()
+	defer s.StopAll()
+
+	waitFor(t, "a running", statusIs(s, "a", "Running"))
+	waitFor(t, "b running", statusIs(s, "b", "Running"))
+
+	info, _ := s.Status("a")
+	if info.PID == 0 || info.StartedAt.IsZero() {
+		t.Errorf("expected PID and start time for running service, got %+v", info)
+	}
+	firstPID := info.PID
+
+	if err := s.Stop("a"); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if info, _ := s.Status("a"); info.Status != "Exited" || info.PID != 0 {
+		t.Errorf("expected a exited without PID, got %+v", info)
+	}
+	if info, _ := s.Status("b"); info.Status != "Running" {
+		t.Errorf("expected b still running, got %s", info.Status)
+	}
+
+	if err := s.Start("a"); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	waitFor(t, "a running again", statusIs(s, "a", "Running"))
+	if err := s.Start("a"); err == nil {
+		t.Error("expected error starting a running service")
+	}
+
+	if err := s.Restart("a"); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	waitFor(t, "a restarted", statusIs(s, "a", "Running"))
+	if info, _ := s.Status("a"); info.PID == firstPID {
+		t.Errorf("expected a new PID after restart, got %d", info.PID)
+	}
+}
+
+// TestSupervisor_UnknownService returns ErrUnknownService for every operation.
+func TestSupervisor_UnknownService(t *testing.T) {
+	s := New(Options{})
+	for op, err := range map[string]error{
+		"start":   s.Start("nope"),
+		"stop":    s.Stop("nope"),
+		"restart": s.Restart("nope"),
+	} {
+		if !errors.Is(err, ErrUnknownService) {
+			t.Errorf("%s: expected ErrUnknownService, got %v", op, err)
+		}
+	}
+	if _, err := s.Status("nope"); !errors.Is(err, ErrUnknownService) {
+		t.Errorf("status: expected ErrUnknownService, got %v", err)
+	}
+}
+
+// TestSupervisor_List returns services in start order.
+func TestSupervisor_List(t *testing.T) {
+	s := New(Options{Services: []config.ServiceConfig{
+		{Name: "db", Mode: "dev"},
+		{Name: "api"},
+	}})
+	infos := s.List()
+	if len(infos) != 2 || infos[0].Name != "db" || infos[0].Mode != "dev" || infos[1].Name != "api" {
+		t.Fatalf("unexpected list: %+v", infos)
+	}
+	if infos[0].Status != "Pending" {
+		t.Errorf("expected Pending before start, got %s", infos[0].Status)
+	}
+}
+
+// TestSupervisor_StopAllReverseOrder stops dependents before their dependencies.
+func TestSupervisor_StopAllReverseOrder(t *testing.T) {
+	rec := &recorder{}
+	s := New(Options{Services: []config.ServiceConfig{
+		{Name: "db", Cmd: loop},
+		{Name: "api", Cmd: loop, DependsOn: []config.Dependency{{Service: "db", Condition: config.ConditionStarted}}},
+	}}).SetStatusCallback(rec.status)
+	s.StartAll()
+	waitFor(t, "api running", statusIs(s, "api", "Running"))
+
+	s.StopAll()
+	s.Wait()
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	var stops []string
+	for _, event := range rec.order {
+		if event == "api:Exited" || event == "db:Exited" {
+			stops = append(stops, event)
+		}
+	}
+	if len(stops) != 2 || stops[0] != "api:Exited" {
+		t.Errorf("expected api to exit before db, got %v", stops)
+	}
+}
+
+// TestSupervisor_Wait returns once every service has exited on its own.
+func TestSupervisor_Wait(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	s := New(Options{Services: []config.ServiceConfig{
+		{Name: "a", Cmd: "echo hi"},
+	}}).SetLogCallback(func(name, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, name+":"+line)
+	})
+	s.StartAll()
+	s.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lines) != 1 || lines[0] != "a:hi" {
+		t.Errorf("expected log line from a, got %v", lines)
+	}
+}
+
+// TestSupervisor_Health records the health check result for the running service.
+func TestSupervisor_Health(t *testing.T) {
+	s := New(Options{
+		Services:     []config.ServiceConfig{{Name: "a", Cmd: loop}},
+		HealthChecks: map[string]config.HealthEntry{"a": {URL: "http://localhost"}},
+	}).SetHealthCheck(func(ctx context.Context, name string, entry config.HealthEntry) bool {
+		return name == "a" && entry.URL == "http://localhost"
+	})
+	s.StartAll()
+	defer s.StopAll()
+
+	waitFor(t, "a healthy", func() bool {
+		info, _ := s.Status("a")
+		return info.Health == "Healthy"
+	})
+}
+
+// TestSupervisor_HealthAfterAutoRestart runs the health check again when the
+// restart policy brings a crashed service back.
+func TestSupervisor_HealthAfterAutoRestart(t *testing.T) {
+	var checks atomic.Int32
+	s := New(Options{
+		Services: []config.ServiceConfig{{
+			Name:    "a",
+			Cmd:     "sleep 0.3; exit 1",
+			Restart: config.RestartConfig{Policy: config.RestartAlways, Backoff: 50 * time.Millisecond, MaxBackoff: 50 * time.Millisecond},
+		}},
+		HealthChecks: map[string]config.HealthEntry{"a": {URL: "http://localhost"}},
+	}).SetHealthCheck(func(ctx context.Context, name string, entry config.HealthEntry) bool {
+		// healthy on the first run only
+		return checks.Add(1) == 1
+	})
+	s.StartAll()
+	defer s.StopAll()
+
+	healthIs := func(health string) func() bool {
+		return func() bool {
+			info, _ := s.Status("a")
+			return info.Health == health
+		}
+	}
+	waitFor(t, "a healthy", healthIs("Healthy"))
+	waitFor(t, "a unhealthy after restart", healthIs("Unhealthy"))
+
+	if info, _ := s.Status("a"); info.Restarts == 0 {
+		t.Errorf("expected a restart, got %+v", info)
+	}
+}
+
+// TestSupervisor_LogPatternHealth marks a service healthy when its stderr
+// matches the log pattern, without calling the health func.
+func TestSupervisor_LogPatternHealth(t *testing.T) {
+	s := New(Options{
+		Services: []config.ServiceConfig{
+			{Name: "a", Cmd: "echo booting; sleep 0.1; echo 'ready in 312 ms' >&2; " + loop},
+			{Name: "b", Cmd: "echo booting; " + loop},
+		},
+		HealthChecks: map[string]config.HealthEntry{
+			"a": {LogPattern: `ready in \d+ ms`},
+			"b": {LogPattern: `ready`, TimeoutSeconds: 1},
+		},
+	}).SetHealthCheck(func(ctx context.Context, name string, entry config.HealthEntry) bool {
+		t.Errorf("health func called for log pattern check of %s", name)
+		return false
+	})
+	s.StartAll()
+	defer s.StopAll()
+
+	waitFor(t, "a healthy", func() bool {
+		info, _ := s.Status("a")
+		return info.Health == "Healthy"
+	})
+	waitFor(t, "b unhealthy after timeout", func() bool {
+		info, _ := s.Status("b")
+		return info.Health == "Unhealthy"
+	})
+}
+
+// TestSupervisor_Liveness flips health as liveness probes fail and recover.
+func TestSupervisor_Liveness(t *testing.T) {
+	var passing atomic.Bool
+	passing.Store(true)
+	var mu sync.Mutex
+	var lines []string
+	s := New(Options{
+		Services: []config.ServiceConfig{{Name: "a", Cmd: loop}},
+		HealthChecks: map[string]config.HealthEntry{"a": {
+			URL:      "http://localhost",
+			Liveness: &config.LivenessEntry{IntervalSeconds: 1, FailureThreshold: 1},
+		}},
+	}).
+		SetHealthCheck(func(ctx context.Context, name string, entry config.HealthEntry) bool {
+			return true
+		}).
+		SetLivenessProbe(func(ctx context.Context, name string, entry config.HealthEntry) bool {
+			return passing.Load()
+		}).
+		SetLogCallback(func(name, line string) {
+			mu.Lock()
+			defer mu.Unlock()
+			lines = append(lines, line)
+		})
+	s.StartAll()
+	defer s.StopAll()
+
+	healthIs := func(health string) func() bool {
+		return func() bool {
+			info, _ := s.Status("a")
+			return info.Health == health
+		}
+	}
+	waitFor(t, "a healthy", healthIs("Healthy"))
+
+	passing.Store(false)
+	waitFor(t, "a unhealthy", healthIs("Unhealthy"))
+
+	passing.Store(true)
+	waitFor(t, "a healthy again", healthIs("Healthy"))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lines) != 2 {
+		t.Errorf("expected a failure and a recovery line, got %v", lines)
+	}
+}
+
+// TestSupervisor_LivenessRestart restarts a service after consecutive failed probes.
+func TestSupervisor_LivenessRestart(t *testing.T) {
+	s := New(Options{
+		Services: []config.ServiceConfig{{Name: "a", Cmd: loop}},
+		HealthChecks: map[string]config.HealthEntry{"a": {
+			URL:      "http://localhost",
+			Liveness: &config.LivenessEntry{IntervalSeconds: 1, RestartAfter: 1},
+		}},
+	}).
+		SetHealthCheck(func(ctx context.Context, name string, entry config.HealthEntry) bool {
+			return true
+		}).
+		SetLivenessProbe(func(ctx context.Context, name string, entry config.HealthEntry) bool {
+			return false
+		})
+	s.StartAll()
+	defer s.StopAll()
+
+	waitFor(t, "a running", statusIs(s, "a", "Running"))
+	info, _ := s.Status("a")
+	firstPID := info.PID
+
+	waitFor(t, "a restarted", func() bool {
+		info, _ := s.Status("a")
+		return info.Status == "Running" && info.PID != 0 && info.PID != firstPID
+	})
+}
+
+// TestSupervisor_HealthHistory keeps recorded probe results per service and
+// reports them to the probe callback.
+func TestSupervisor_HealthHistory(t *testing.T) {
+	var mu sync.Mutex
+	var reported []string
+	s := New(Options{
+		Services: []config.ServiceConfig{
+			{Name: "a", Cmd: "echo ready; " + loop},
+			{Name: "b", Cmd: loop},
+		},
+		HealthChecks:  map[string]config.HealthEntry{"a": {LogPattern: "ready"}},
+		HealthHistory: 2,
+	}).SetProbeCallback(func(name string, res health.Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported = append(reported, name)
+	})
+	s.StartAll()
+	defer s.StopAll()
+
+	// the log pattern check records its own result
+	waitFor(t, "a probe recorded", func() bool {
+		results, _ := s.HealthHistory("a")
+		return len(results) == 1 && results[0].OK
+	})
+
+	for _, detail := range []string{"1", "2", "3"} {
+		s.RecordProbe("b", health.Result{Detail: detail})
+	}
+	results, err := s.HealthHistory("b")
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(results) != 2 || results[0].Detail != "2" || results[1].Detail != "3" {
+		t.Errorf("expected the two newest results, got %+v", results)
+	}
+	if _, err := s.HealthHistory("nope"); !errors.Is(err, ErrUnknownService) {
+		t.Errorf("expected ErrUnknownService, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reported) != 4 {
+		t.Errorf("expected 4 reported results, got %v", reported)
+	}
+}
+
+// TestSupervisor_DependencyError reports dependents that cannot start.
+func TestSupervisor_DependencyError(t *testing.T) {
+	var mu sync.Mutex
+	var errs []string
+	s := New(Options{
+		Services: []config.ServiceConfig{
+			{Name: "db", Cmd: "exit 1"},
+			{Name: "api", Cmd: loop, DependsOn: []config.Dependency{{Service: "db", Condition: config.ConditionHealthy}}},
+		},
+		HealthChecks: map[string]config.HealthEntry{"db": {URL: "http://localhost"}},
+	}).SetErrorCallback(func(name string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, name)
+	})
+	s.StartAll()
+	s.Wait()
+
+	if info, _ := s.Status("api"); info.Status != "Error" {
+		t.Errorf("expected api Error, got %s", info.Status)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 2 {
+		t.Errorf("expected errors for db and api, got %v", errs)
+	}
+}
+
+// TestSupervisor_DependencyRestarts keeps a dependent waiting while its
+// dependency crashes and is brought back by its restart policy.
+func TestSupervisor_DependencyRestarts(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "crashed")
+	var mu sync.Mutex
+	var errs []string
+	s := New(Options{
+		Services: []config.ServiceConfig{
+			{
+				Name:    "a",
+				Cmd:     "if [ -f " + marker + " ]; then echo ready; " + loop + "; else touch " + marker + "; exit 1; fi",
+				Restart: config.RestartConfig{Policy: config.RestartOnFailure, Backoff: 50 * time.Millisecond, MaxBackoff: 50 * time.Millisecond},
+			},
+			{Name: "b", Cmd: loop, DependsOn: []config.Dependency{{Service: "a", Condition: config.ConditionHealthy}}},
+		},
+		HealthChecks: map[string]config.HealthEntry{"a": {LogPattern: "ready"}},
+	}).SetErrorCallback(func(name string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, name+": "+err.Error())
+	})
+	s.StartAll()
+	defer s.StopAll()
+
+	waitFor(t, "b running", statusIs(s, "b", "Running"))
+	if info, _ := s.Status("a"); info.Restarts != 1 || info.Health != "Healthy" {
+		t.Errorf("expected a healthy after one restart, got %+v", info)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+}
+
+// TestSupervisor_RestartAll restarts every service and reports them active.
+func TestSupervisor_RestartAll(t *testing.T) {
+	s := New(Options{Services: []config.ServiceConfig{
+		{Name: "a", Cmd: loop},
+		{Name: "b", Cmd: loop},
+	}})
+	if info, _ := s.Status("a"); info.Active {
+		t.Error("expected a inactive before start")
+	}
+	s.StartAll()
+	defer s.StopAll()
+	waitFor(t, "a running", statusIs(s, "a", "Running"))
+	waitFor(t, "b running", statusIs(s, "b", "Running"))
+	before := map[string]int{}
+	for _, info := range s.List() {
+		before[info.Name] = info.PID
+	}
+
+	s.RestartAll()
+	waitFor(t, "a running again", statusIs(s, "a", "Running"))
+	waitFor(t, "b running again", statusIs(s, "b", "Running"))
+	for _, info := range s.List() {
+		if !info.Active || info.PID == before[info.Name] {
+			t.Errorf("expected %s restarted and active, got %+v", info.Name, info)
+		}
+	}
+}
+
+// TestSupervisor_Logs buffers output per service, keeping only the newest lines.
+func TestSupervisor_Logs(t *testing.T) {
+	s := New(Options{
+		Services: []config.ServiceConfig{{Name: "a", Cmd: "for i in 1 2 3 4; do echo line$i; done"}},
+		LogLines: 2,
+	})
+	s.StartAll()
+	s.Wait()
+
+	lines, err := s.Logs("a")
+	if err != nil {
+		t.Fatalf("logs: %v", err)
+	}
+	if len(lines) != 2 || lines[0] != "line3" || lines[1] != "line4" {
+		t.Errorf("expected [line3 line4], got %v", lines)
+	}
+	if _, err := s.Logs("nope"); !errors.Is(err, ErrUnknownService) {
+		t.Errorf("expected ErrUnknownService, got %v", err)
+	}
+}
+
+// TestSupervisor_Subscribe streams new lines and filters only the log callback.
+func TestSupervisor_Subscribe(t *testing.T) {
+	var mu sync.Mutex
+	var shown []string
+	s := New(Options{
+		Services: []config.ServiceConfig{{Name: "a", Cmd: "sleep 0.2; echo hello"}},
+		Filter:   filter.New(nil, []string{"a"}),
+	}).SetLogCallback(func(name, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		shown = append(shown, line)
+	})
+
+	backlog, lines, unsubscribe, err := s.Subscribe("a")
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer unsubscribe()
+	if len(backlog) != 0 {
+		t.Errorf("expected empty backlog, got %v", backlog)
+	}
+
+	s.StartAll()
+	defer s.StopAll()
+
+	select {
+	case line := <-lines:
+		if line != "hello" {
+			t.Errorf("expected hello, got %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for subscribed line")
+	}
+
+	s.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(shown) != 0 {
+		t.Errorf("expected muted service to skip the log callback, got %v", shown)
+	}
+}
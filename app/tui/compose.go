@@ -0,0 +1,219 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/simiancreative/treehouse/app/colors"
+	"github.com/simiancreative/treehouse/app/config"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// defaultModeLabel is shown for a service running its default command.
+const defaultModeLabel = "default"
+
+var (
+	composeHeaderStyle = lipgloss.NewStyle().
+				Bold(true).
+				Foreground(lipgloss.Color(colors.Header))
+
+	composeOptionalStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color(colors.Pending))
+)
+
+// composeItem is a single service row in the compose picker.
+type composeItem struct {
+	name     string
+	optional bool
+	selected bool
+	// modes lists the selectable modes; index 0 is the default command ("").
+	modes []string
+	mode  int
+}
+
+type composeModel struct {
+	keys composeKeyMap
+	help help.Model
+
+	items  []composeItem
+	cursor int
+
+	confirmed bool
+}
+
+// newComposeModel builds the picker rows from the config. Core services are
+// selected by default, optional services are not. Each service starts in the
+// given mode when it defines it, otherwise in its default command.
+func newComposeModel(cfg *config.Config, mode string) *composeModel {
+	m := &composeModel{
+		keys: composeKeys,
+		help: help.New(),
+	}
+
+	add := func(services map[string]config.Service, optional bool) {
+		names := make([]string, 0, len(services))
+		for name := range services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			item := composeItem{
+				name:     name,
+				optional: optional,
+				selected: !optional,
+				modes:    []string{""},
+			}
+
+			modes := make([]string, 0, len(services[name].Modes))
+			for modeName := range services[name].Modes {
+				modes = append(modes, modeName)
+			}
+			sort.Strings(modes)
+			item.modes = append(item.modes, modes...)
+
+			for i, modeName := range item.modes {
+				if mode != "" && modeName == mode {
+					item.mode = i
+				}
+			}
+
+			m.items = append(m.items, item)
+		}
+	}
+
+	add(cfg.CoreServices, false)
+	add(cfg.OptionalServices, true)
+
+	return m
+}
+
+func (m composeModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m *composeModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.help.Width = msg.Width
+
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.keys.Quit):
+			return m, tea.Quit
+
+		case key.Matches(msg, m.keys.Confirm):
+			m.confirmed = true
+			return m, tea.Quit
+
+		case key.Matches(msg, m.keys.Help):
+			m.help.ShowAll = !m.help.ShowAll
+
+		case key.Matches(msg, m.keys.Up):
+			if m.cursor > 0 {
+				m.cursor--
+			}
+
+		case key.Matches(msg, m.keys.Down):
+			if m.cursor < len(m.items)-1 {
+				m.cursor++
+			}
+
+		case key.Matches(msg, m.keys.Toggle):
+			if len(m.items) > 0 {
+				m.items[m.cursor].selected = !m.items[m.cursor].selected
+			}
+
+		case key.Matches(msg, m.keys.Prev):
+			if len(m.items) > 0 {
+				item := &m.items[m.cursor]
+				item.mode = (item.mode - 1 + len(item.modes)) % len(item.modes)
+			}
+
+		case key.Matches(msg, m.keys.Next):
+			if len(m.items) > 0 {
+				item := &m.items[m.cursor]
+				item.mode = (item.mode + 1) % len(item.modes)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+func (m composeModel) View() string {
+	var b strings.Builder
+
+	b.WriteString(composeHeaderStyle.Render("Select services and modes"))
+	b.WriteString("\n\n")
+
+	for i, item := range m.items {
+		prefix := "  "
+		if i == m.cursor {
+			prefix = "> "
+		}
+		check := "[ ]"
+		if item.selected {
+			check = "[x]"
+		}
+		modeLabel := item.modes[item.mode]
+		if modeLabel == "" {
+			modeLabel = defaultModeLabel
+		}
+		name := item.name
+		if item.optional {
+			name += composeOptionalStyle.Render(" (optional)")
+		}
+
+		text := fmt.Sprintf("%s%s %s  mode: ‹%s›", prefix, check, name, modeLabel)
+		if i == m.cursor {
+			text = selectedStyle.Render(text)
+		}
+		b.WriteString(text + "\n")
+	}
+
+	b.WriteString("\n" + m.help.View(m.keys))
+
+	return b.String()
+}
+
+// selection returns the checked services with their chosen modes, or nil if
+// the picker was cancelled.
+func (m *composeModel) selection() []config.Selection {
+	if !m.confirmed {
+		return nil
+	}
+
+	var selection []config.Selection
+	for _, item := range m.items {
+		if !item.selected {
+			continue
+		}
+		selection = append(selection, config.Selection{
+			Name: item.name,
+			Mode: item.modes[item.mode],
+		})
+	}
+	return selection
+}
+
+// Compose shows the interactive service and mode picker and returns the
+// chosen services. It returns nil when the picker is cancelled or nothing is
+// selected.
+func Compose(cfg *config.Config, mode string) ([]config.Selection, error) {
+	m := newComposeModel(cfg, mode)
+	if len(m.items) == 0 {
+		return nil, fmt.Errorf("no services defined in config")
+	}
+
+	if _, err := tea.NewProgram(m, tea.WithAltScreen()).Run(); err != nil {
+		return nil, fmt.Errorf("error starting compose menu: %w", err)
+	}
+
+	return m.selection(), nil
+}
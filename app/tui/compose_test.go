@@ -0,0 +1,119 @@
+package tui
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/simiancreative/treehouse/app/config"
+)
+
+func composeTestConfig() *config.Config {
+	return &config.Config{
+		CoreServices: map[string]config.Service{
+			"web": {
+				Command: "run-web",
+				Modes: map[string]config.ServiceMode{
+					"prod": {Command: "run-web --prod"},
+					"auth": {Command: "run-web --auth"},
+				},
+			},
+			"api": {Command: "run-api"},
+		},
+		OptionalServices: map[string]config.Service{
+			"oidc": {Command: "run-oidc"},
+		},
+	}
+}
+
+func keyRune(r rune) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}}
+}
+
+// TestNewComposeModel lists core services selected and optional services unselected.
+func TestNewComposeModel(t *testing.T) {
+	m := newComposeModel(composeTestConfig(), "prod")
+	var names []string
+	for _, item := range m.items {
+		names = append(names, item.name)
+	}
+	want := []string{"api", "web", "oidc"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("items: expected %v, got %v", want, names)
+	}
+	if !m.items[0].selected || !m.items[1].selected || m.items[2].selected {
+		t.Errorf("expected core selected and optional unselected, got %+v", m.items)
+	}
+	// web defines "prod", so it starts in that mode
+	if got := m.items[1].modes[m.items[1].mode]; got != "prod" {
+		t.Errorf("web mode: expected prod, got %q", got)
+	}
+	// api has no "prod" mode, so it uses its default command
+	if got := m.items[0].modes[m.items[0].mode]; got != "" {
+		t.Errorf("api mode: expected default, got %q", got)
+	}
+}
+
+// TestComposeModel_Selection toggles services, cycles modes and confirms.
+func TestComposeModel_Selection(t *testing.T) {
+	var m tea.Model = newComposeModel(composeTestConfig(), "")
+	// deselect api
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeySpace})
+	// move to web and cycle to its first mode ("auth")
+	m, _ = m.Update(keyRune('j'))
+	m, _ = m.Update(keyRune('l'))
+	// move to oidc and select it
+	m, _ = m.Update(keyRune('j'))
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeySpace})
+	// confirm
+	m, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd == nil || cmd() != tea.Quit() {
+		t.Fatal("expected confirm to quit the picker")
+	}
+
+	got := m.(*composeModel).selection()
+	want := []config.Selection{{Name: "web", Mode: "auth"}, {Name: "oidc", Mode: ""}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("selection: expected %v, got %v", want, got)
+	}
+}
+
+// TestComposeModel_ModeWraps cycles backwards past the default command.
+func TestComposeModel_ModeWraps(t *testing.T) {
+	var m tea.Model = newComposeModel(composeTestConfig(), "")
+	m, _ = m.Update(keyRune('j'))
+	m, _ = m.Update(keyRune('h'))
+	mod := m.(*composeModel)
+	if got := mod.items[1].modes[mod.items[1].mode]; got != "prod" {
+		t.Errorf("expected mode to wrap to prod, got %q", got)
+	}
+}
+
+// TestComposeModel_Cancel returns no selection when the picker is quit.
+func TestComposeModel_Cancel(t *testing.T) {
+	var m tea.Model = newComposeModel(composeTestConfig(), "")
+	m, _ = m.Update(keyRune('q'))
+	if got := m.(*composeModel).selection(); got != nil {
+		t.Errorf("expected nil selection after cancel, got %v", got)
+	}
+}
+
+// TestComposeModel_View renders every service and its mode.
+func TestComposeModel_View(t *testing.T) {
+	m := newComposeModel(composeTestConfig(), "prod")
+	v := m.View()
+	for _, s := range []string{"api", "web", "oidc", "optional", "prod", defaultModeLabel} {
+		if !strings.Contains(v, s) {
+			t.Errorf("expected %q in view, got %q", s, v)
+		}
+	}
+}
+
+// TestCompose_NoServices returns an error for an empty config.
+func TestCompose_NoServices(t *testing.T) {
+	if _, err := Compose(&config.Config{}, ""); err == nil {
+		t.Fatal("expected error for config without services")
+	}
+}
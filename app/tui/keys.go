@@ -12,12 +12,17 @@ type keyMap struct {
 	Tab   key.Binding
 	Help  key.Binding
 	Quit  key.Binding
+
+	Restart    key.Binding
+	Toggle     key.Binding
+	RestartAll key.Binding
+	Details    key.Binding
 }
 
 // ShortHelp returns keybindings to be shown in the mini help view. It's part
 // of the key.Map interface.
 func (k keyMap) ShortHelp() []key.Binding {
-	return []key.Binding{k.Up, k.Down, k.Left, k.Right, k.Tab, k.Help, k.Quit}
+	return []key.Binding{k.Up, k.Down, k.Left, k.Right, k.Restart, k.Toggle, k.Details, k.Tab, k.Help, k.Quit}
 }
 
 // FullHelp returns keybindings for the expanded help view. It's part of the
@@ -25,6 +30,7 @@ func (k keyMap) ShortHelp() []key.Binding {
 func (k keyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
 		{k.Up, k.Down, k.Left, k.Right},
+		{k.Restart, k.Toggle, k.RestartAll, k.Details},
 		{k.Tab, k.Help, k.Quit},
 	}
 }
@@ -58,4 +64,81 @@ var keys = keyMap{
 		key.WithKeys("q", "esc", "ctrl+c"),
 		key.WithHelp("q", "quit"),
 	),
+	Restart: key.NewBinding(
+		key.WithKeys("r"),
+		key.WithHelp("r", "restart service"),
+	),
+	Toggle: key.NewBinding(
+		key.WithKeys("s"),
+		key.WithHelp("s", "stop/start service"),
+	),
+	RestartAll: key.NewBinding(
+		key.WithKeys("R"),
+		key.WithHelp("R", "restart all"),
+	),
+	Details: key.NewBinding(
+		key.WithKeys("d"),
+		key.WithHelp("d", "health details"),
+	),
+}
+
+// composeKeyMap defines the keybindings for the compose service picker.
+type composeKeyMap struct {
+	Up      key.Binding
+	Down    key.Binding
+	Toggle  key.Binding
+	Prev    key.Binding
+	Next    key.Binding
+	Confirm key.Binding
+	Help    key.Binding
+	Quit    key.Binding
+}
+
+// ShortHelp returns keybindings to be shown in the mini help view.
+func (k composeKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Toggle, k.Prev, k.Next, k.Confirm, k.Help, k.Quit}
+}
+
+// FullHelp returns keybindings for the expanded help view.
+func (k composeKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Up, k.Down, k.Toggle},
+		{k.Prev, k.Next},
+		{k.Confirm, k.Help, k.Quit},
+	}
+}
+
+var composeKeys = composeKeyMap{
+	Up: key.NewBinding(
+		key.WithKeys("up", "k"),
+		key.WithHelp("↑/k", "move up"),
+	),
+	Down: key.NewBinding(
+		key.WithKeys("down", "j"),
+		key.WithHelp("↓/j", "move down"),
+	),
+	Toggle: key.NewBinding(
+		key.WithKeys(" ", "x"),
+		key.WithHelp("space", "toggle service"),
+	),
+	Prev: key.NewBinding(
+		key.WithKeys("left", "h"),
+		key.WithHelp("←/h", "previous mode"),
+	),
+	Next: key.NewBinding(
+		key.WithKeys("right", "l"),
+		key.WithHelp("→/l", "next mode"),
+	),
+	Confirm: key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "start selected"),
+	),
+	Help: key.NewBinding(
+		key.WithKeys("?"),
+		key.WithHelp("?", "toggle help"),
+	),
+	Quit: key.NewBinding(
+		key.WithKeys("q", "esc", "ctrl+c"),
+		key.WithHelp("q", "cancel"),
+	),
 }
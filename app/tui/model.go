@@ -3,10 +3,14 @@ package tui
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/simiancreative/treehouse/app/colors"
 	"github.com/simiancreative/treehouse/app/config"
+	"github.com/simiancreative/treehouse/app/filter"
+	"github.com/simiancreative/treehouse/app/health"
 	"github.com/simiancreative/treehouse/app/service"
+	"github.com/simiancreative/treehouse/app/supervisor"
 
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
@@ -46,12 +50,27 @@ var (
 			Foreground(lipgloss.Color(colors.Crashed))
 	exitedStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color(colors.Exited))
+	restartingStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color(colors.Restarting))
+	crashLoopStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color(colors.CrashLoop))
 	healthyStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color(colors.Healthy))
 	unhealthyStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color(colors.Unhealthy))
 )
 
+// controller starts, stops and restarts individual services. It is
+// satisfied by *supervisor.Supervisor.
+type controller interface {
+	Start(name string) error
+	Stop(name string) error
+	Restart(name string) error
+	RestartAll()
+	Status(name string) (supervisor.Info, error)
+}
+
 type model struct {
 	keys keyMap
 	help help.Model
@@ -59,6 +78,8 @@ type model struct {
 	services []config.ServiceConfig
 	logs     map[string][]string
 	statuses map[string]string
+	restarts map[string]int
+	health   map[string]*health.History
 
 	selected int
 	sidebar  viewport.Model
@@ -67,14 +88,25 @@ type model struct {
 	height   int
 
 	viewFocus string // "sidebar" or "content"
-	svcFocus  string
-	svcMute   string
+	// details shows the selected service's health check history instead of
+	// its logs.
+	details bool
+	// svcFilter hides the services left out by --focus and --mute.
+	svcFilter filter.Filter
+
+	// ctl acts on the selected service; nil disables the control keys.
+	ctl controller
+
+	// shutdown stops all services before quitting; a second quit key press
+	// while stopping quits immediately.
+	shutdown func()
+	stopping bool
 }
 
 func NewModel(
 	services []config.ServiceConfig,
 	hcMap map[string]config.HealthEntry,
-	focus, mute string,
+	focus, mute []string,
 ) *model {
 	side := viewport.New(0, 0)
 	main := viewport.New(0, 0)
@@ -95,11 +127,12 @@ func NewModel(
 		services: services,
 		logs:     logs,
 		statuses: statuses,
+		restarts: make(map[string]int),
+		health:   make(map[string]*health.History),
 
 		sidebar:   side,
 		content:   main,
-		svcFocus:  focus,
-		svcMute:   mute,
+		svcFilter: filter.New(focus, mute),
 		viewFocus: "sidebar",
 	}
 
@@ -119,10 +152,7 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case LogMsg:
 		// filters
-		if m.svcFocus != "" && msg.Service != m.svcFocus {
-			return m, nil
-		}
-		if m.svcMute != "" && msg.Service == m.svcMute {
+		if !m.svcFilter.Shown(msg.Service) {
 			return m, nil
 		}
 		// append log and keep last N
@@ -130,22 +160,38 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		lines = append(lines, msg.Line)
 		m.logs[msg.Service] = lines
 		// if for selected service, update viewport
-		if msg.Service == m.services[m.selected].Name {
-			m.content.SetContent(strings.Join(lines, "\n"))
-			m.content.GotoBottom()
+		if msg.Service == m.services[m.selected].Name && !m.details {
+			m.refreshContent()
 		}
 		return m, nil
 
 	case StatusMsg:
-		if m.svcFocus != "" && msg.Service != m.svcFocus {
-			return m, nil
-		}
-		if m.svcMute != "" && msg.Service == m.svcMute {
+		if !m.svcFilter.Shown(msg.Service) {
 			return m, nil
 		}
 		m.statuses[msg.Service] = msg.Status
 		m.sidebar.SetContent(m.sidebarContent())
 		return m, nil
+
+	case RestartMsg:
+		m.restarts[msg.Service] = msg.Attempt
+		m.sidebar.SetContent(m.sidebarContent())
+		return m, nil
+
+	case HealthMsg:
+		if !m.svcFilter.Shown(msg.Service) {
+			return m, nil
+		}
+		history, ok := m.health[msg.Service]
+		if !ok {
+			history = health.NewHistory(health.DefaultHistorySize)
+			m.health[msg.Service] = history
+		}
+		history.Add(msg.Result)
+		if msg.Service == m.services[m.selected].Name && m.details {
+			m.refreshContent()
+		}
+		return m, nil
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
@@ -160,7 +206,15 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		switch {
 
 		case key.Matches(msg, m.keys.Quit):
-			return m, tea.Quit
+			if m.shutdown == nil || m.stopping {
+				return m, tea.Quit
+			}
+			m.stopping = true
+			shutdown := m.shutdown
+			return m, func() tea.Msg {
+				shutdown()
+				return tea.Quit()
+			}
 
 		case key.Matches(msg, m.keys.Up):
 			if m.viewFocus == "sidebar" {
@@ -168,9 +222,7 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.selected--
 				}
 				// load new logs
-				svc := m.services[m.selected].Name
-				m.content.SetContent(strings.Join(m.logs[svc], "\n"))
-				m.content.GotoBottom()
+				m.refreshContent()
 				m.sidebar.SetContent(m.sidebarContent())
 				return m, nil
 			}
@@ -180,13 +232,39 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if m.selected < len(m.services)-1 {
 					m.selected++
 				}
-				svc := m.services[m.selected].Name
-				m.content.SetContent(strings.Join(m.logs[svc], "\n"))
-				m.content.GotoBottom()
+				m.refreshContent()
 				m.sidebar.SetContent(m.sidebarContent())
 				return m, nil
 			}
 
+		case key.Matches(msg, m.keys.Restart):
+			return m, m.control("restart", func(ctl controller, name string) error {
+				return ctl.Restart(name)
+			})
+
+		case key.Matches(msg, m.keys.Toggle):
+			return m, m.control("stop/start", func(ctl controller, name string) error {
+				if info, err := ctl.Status(name); err == nil && !info.Active {
+					return ctl.Start(name)
+				}
+				return ctl.Stop(name)
+			})
+
+		case key.Matches(msg, m.keys.RestartAll):
+			if m.ctl == nil || m.stopping {
+				return m, nil
+			}
+			ctl := m.ctl
+			return m, func() tea.Msg {
+				ctl.RestartAll()
+				return nil
+			}
+
+		case key.Matches(msg, m.keys.Details):
+			m.details = !m.details
+			m.refreshContent()
+			return m, nil
+
 		case key.Matches(msg, m.keys.Left):
 			m.content.ScrollLeft(m.content.Width)
 
@@ -216,6 +294,99 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+// control returns a command that runs action on the selected service in the
+// background. Status changes arrive as StatusMsg; a failure is appended to the
+// service's log.
+func (m *model) control(what string, action func(ctl controller, name string) error) tea.Cmd {
+	if m.ctl == nil || m.stopping || len(m.services) == 0 {
+		return nil
+	}
+	ctl, name := m.ctl, m.services[m.selected].Name
+	return func() tea.Msg {
+		if err := action(ctl, name); err != nil {
+			return LogMsg{Service: name, Line: fmt.Sprintf("%s failed: %v", what, err)}
+		}
+		return nil
+	}
+}
+
+// refreshContent shows the selected service's logs, scrolled to the newest
+// line, or its health check history when the details pane is open.
+func (m *model) refreshContent() {
+	if len(m.services) == 0 {
+		return
+	}
+	name := m.services[m.selected].Name
+	if m.details {
+		m.content.SetContent(m.detailsContent(name))
+		m.content.GotoTop()
+		return
+	}
+	m.content.SetContent(strings.Join(m.logs[name], "\n"))
+	m.content.GotoBottom()
+}
+
+// detailsContent renders a service's health check history: a sparkline of
+// recent latencies followed by each attempt, newest first.
+func (m *model) detailsContent(name string) string {
+	history, ok := m.health[name]
+	if !ok {
+		return fmt.Sprintf("Health checks for %s\n\nNo health checks yet.", name)
+	}
+	results := history.Results()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Health checks for %s (last %d)\n\n", name, len(results))
+
+	width := m.content.Width
+	if width <= 0 || width > len(results) {
+		width = len(results)
+	}
+	b.WriteString(sparkline(results[len(results)-width:]) + "\n\n")
+
+	for i := len(results) - 1; i >= 0; i-- {
+		res := results[i]
+		outcome := healthyStyle.Render("ok  ")
+		if !res.OK {
+			outcome = unhealthyStyle.Render("fail")
+		}
+		line := fmt.Sprintf("%s  %s  %8s  %s", res.Time.Format("15:04:05"), outcome, res.Latency.Round(time.Millisecond), res.Detail)
+		if res.Err != nil {
+			line += "  " + res.Err.Error()
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// sparkBlocks are the bar heights of a sparkline, lowest first.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws one bar per result scaled to the highest latency; failed
+// attempts are drawn as a red cross.
+func sparkline(results []health.Result) string {
+	var max time.Duration
+	for _, res := range results {
+		if res.Latency > max {
+			max = res.Latency
+		}
+	}
+
+	var b strings.Builder
+	for _, res := range results {
+		if !res.OK {
+			b.WriteString(unhealthyStyle.Render("×"))
+			continue
+		}
+		i := 0
+		if max > 0 {
+			i = int(int64(res.Latency) * int64(len(sparkBlocks)-1) / int64(max))
+		}
+		b.WriteString(healthyStyle.Render(string(sparkBlocks[i])))
+	}
+	return b.String()
+}
+
 func (m model) View() string {
 	side := sidebarStyle.Render(m.sidebar.View())
 	content := contentStyle.Render(m.content.View())
@@ -247,6 +418,9 @@ func (m *model) sidebarContent() string {
 		}
 		status := styleStatus(m.statuses[svc.Name])
 		text := fmt.Sprintf("%s%s [%s]", prefix, svc.Name, status)
+		if n := m.restarts[svc.Name]; n > 0 {
+			text += fmt.Sprintf(" ↻%d", n)
+		}
 		if i == m.selected {
 			text = selectedStyle.Render(text)
 		}
@@ -280,8 +454,12 @@ func styleStatus(status string) string {
 		s = runningStyle
 	case service.Statuses["Healthy"]:
 		s = healthyStyle
-	case service.Statuses["Unhealthy"], service.Statuses["Restarting"], service.Statuses["Stopping"]:
+	case service.Statuses["Unhealthy"], service.Statuses["Stopping"]:
 		s = crashedStyle
+	case service.Statuses["Restarting"]:
+		s = restartingStyle
+	case service.Statuses["CrashLoop"]:
+		s = crashLoopStyle
 	case service.Statuses["Exited"]:
 		s = exitedStyle
 	default:
@@ -1,14 +1,18 @@
 package tui
 
 import (
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 
 	"github.com/simiancreative/treehouse/app/config"
+	"github.com/simiancreative/treehouse/app/health"
 	"github.com/simiancreative/treehouse/app/service"
+	"github.com/simiancreative/treehouse/app/supervisor"
 )
 
 // TestStyleStatus ensures styleStatus renders the status text.
@@ -24,10 +28,10 @@ func TestStyleStatus(t *testing.T) {
 // TestNewModelWithFocus sets initial selection based on focus flag.
 func TestNewModelWithFocus(t *testing.T) {
 	services := []config.ServiceConfig{{Name: "a"}, {Name: "b"}, {Name: "c"}}
-	// NewModel returns *model; svcFocus should be set, selection remains default 0
-	mod := NewModel(services, nil, "b", "")
-	if mod.svcFocus != "b" {
-		t.Errorf("svcFocus: expected %q, got %q", "b", mod.svcFocus)
+	// NewModel returns *model; the focus filter should be set, selection remains default 0
+	mod := NewModel(services, nil, []string{"b"}, nil)
+	if len(mod.svcFilter.Focus) != 1 || mod.svcFilter.Focus[0] != "b" {
+		t.Errorf("svcFilter.Focus: expected [b], got %v", mod.svcFilter.Focus)
 	}
 	if mod.selected != 0 {
 		t.Errorf("selected: expected default 0, got %d", mod.selected)
@@ -38,7 +42,7 @@ func TestNewModelWithFocus(t *testing.T) {
 func TestUpdateFocusFiltering(t *testing.T) {
 	services := []config.ServiceConfig{{Name: "a"}, {Name: "b"}}
 	// focus on "a"
-	var m tea.Model = NewModel(services, nil, "a", "")
+	var m tea.Model = NewModel(services, nil, []string{"a"}, nil)
 	// Log for b should be ignored
 	updated, _ := m.Update(LogMsg{Service: "b", Line: "ignored"})
 	mod := updated.(*model)
@@ -57,7 +61,7 @@ func TestUpdateFocusFiltering(t *testing.T) {
 func TestUpdateMuteFiltering(t *testing.T) {
 	services := []config.ServiceConfig{{Name: "a"}, {Name: "b"}}
 	// mute "b"
-	var m tea.Model = NewModel(services, nil, "", "b")
+	var m tea.Model = NewModel(services, nil, nil, []string{"b"})
 	// Log for b should be ignored
 	updated, _ := m.Update(LogMsg{Service: "b", Line: "ignored"})
 	mod := updated.(*model)
@@ -73,11 +77,24 @@ func TestUpdateMuteFiltering(t *testing.T) {
 	}
 }
 
+// TestUpdatePatternFiltering mutes every service matching a glob pattern.
+func TestUpdatePatternFiltering(t *testing.T) {
+	services := []config.ServiceConfig{{Name: "api"}, {Name: "worker-a"}, {Name: "worker-b"}}
+	var m tea.Model = NewModel(services, nil, nil, []string{"db,worker-*"})
+	for _, svc := range services {
+		m, _ = m.Update(LogMsg{Service: svc.Name, Line: "line"})
+	}
+	mod := m.(*model)
+	if len(mod.logs["api"]) != 1 || len(mod.logs["worker-a"]) != 0 || len(mod.logs["worker-b"]) != 0 {
+		t.Errorf("expected only api logs, got %v", mod.logs)
+	}
+}
+
 // TestNewModel initializes model and checks default state.
 func TestNewModel(t *testing.T) {
 	services := []config.ServiceConfig{{Name: "svc1"}, {Name: "svc2"}}
 	hcMap := map[string]config.HealthEntry{"svc1": {URL: "u", Codes: []int{200}}}
-	mod := NewModel(services, hcMap, "", "")
+	mod := NewModel(services, hcMap, nil, nil)
 	// services list should match
 	if !reflect.DeepEqual(mod.services, services) {
 		t.Errorf("services mismatch: expected %v, got %v", services, mod.services)
@@ -100,7 +117,7 @@ func TestNewModel(t *testing.T) {
 func TestUpdate_LogMsg(t *testing.T) {
 	services := []config.ServiceConfig{{Name: "s"}}
 	// start with fresh model
-	var m tea.Model = NewModel(services, nil, "", "")
+	var m tea.Model = NewModel(services, nil, nil, nil)
 	const total = 10
 	// append several log lines
 	for i := 0; i < total; i++ {
@@ -116,7 +133,7 @@ func TestUpdate_LogMsg(t *testing.T) {
 // TestUpdate_StatusMsg updates service status.
 func TestUpdate_StatusMsg(t *testing.T) {
 	services := []config.ServiceConfig{{Name: "s"}}
-	var m tea.Model = NewModel(services, nil, "", "")
+	var m tea.Model = NewModel(services, nil, nil, nil)
 	updated, _ := m.Update(StatusMsg{Service: "s", Status: service.Statuses["Running"]})
 	mod := updated.(*model)
 	if mod.statuses["s"] != service.Statuses["Running"] {
@@ -124,10 +141,79 @@ func TestUpdate_StatusMsg(t *testing.T) {
 	}
 }
 
+// TestUpdate_RestartMsg records restarts and shows them in the sidebar.
+func TestUpdate_RestartMsg(t *testing.T) {
+	services := []config.ServiceConfig{{Name: "s"}}
+	var m tea.Model = NewModel(services, nil, nil, nil)
+	updated, _ := m.Update(RestartMsg{Service: "s", Attempt: 3})
+	mod := updated.(*model)
+	if mod.restarts["s"] != 3 {
+		t.Errorf("expected 3 restarts, got %d", mod.restarts["s"])
+	}
+	if !strings.Contains(mod.sidebarContent(), "↻3") {
+		t.Errorf("expected restart count in sidebar, got %q", mod.sidebarContent())
+	}
+}
+
+// TestUpdate_HealthMsg records health results and shows them in the details pane.
+func TestUpdate_HealthMsg(t *testing.T) {
+	services := []config.ServiceConfig{{Name: "s"}}
+	var m tea.Model = NewModel(services, nil, nil, nil)
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 120, Height: 20})
+	m, _ = m.Update(LogMsg{Service: "s", Line: "log line"})
+	m, _ = m.Update(HealthMsg{Service: "s", Result: health.Result{
+		Time:    time.Date(2024, 1, 1, 15, 4, 5, 0, time.UTC),
+		Latency: 3 * time.Millisecond,
+		Err:     errors.New("connection refused"),
+	}})
+	m, _ = m.Update(HealthMsg{Service: "s", Result: health.Result{OK: true, Detail: "200", Latency: time.Millisecond}})
+	mod := m.(*model)
+	if got := len(mod.health["s"].Results()); got != 2 {
+		t.Fatalf("expected 2 health results, got %d", got)
+	}
+
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("d")})
+	mod = m.(*model)
+	if !mod.details {
+		t.Fatal("expected details pane open")
+	}
+	details := mod.detailsContent("s")
+	for _, want := range []string{"15:04:05", "connection refused", "200", "×"} {
+		if !strings.Contains(details, want) {
+			t.Errorf("expected details to contain %q, got %q", want, details)
+		}
+	}
+
+	// new log lines do not replace the details pane
+	m, _ = m.Update(LogMsg{Service: "s", Line: "another line"})
+	if view := m.(*model).content.View(); strings.Contains(view, "another line") || !strings.Contains(view, "Health checks for s") {
+		t.Errorf("expected details pane to stay open on new logs, got %q", view)
+	}
+
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("d")})
+	if m.(*model).details || !strings.Contains(m.(*model).content.View(), "another line") {
+		t.Error("expected details pane closed and logs shown")
+	}
+}
+
+// TestSparkline draws a bar per result and a cross for failures.
+func TestSparkline(t *testing.T) {
+	line := sparkline([]health.Result{
+		{OK: true, Latency: time.Millisecond},
+		{OK: true, Latency: 8 * time.Millisecond},
+		{OK: false},
+	})
+	for _, want := range []string{"▁", "█", "×"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("expected sparkline to contain %q, got %q", want, line)
+		}
+	}
+}
+
 // TestUpdate_KeyMsg navigates selection and quits.
 func TestUpdate_KeyMsg(t *testing.T) {
 	services := []config.ServiceConfig{{Name: "a"}, {Name: "b"}}
-	var m tea.Model = NewModel(services, nil, "", "")
+	var m tea.Model = NewModel(services, nil, nil, nil)
 	// move down (j)
 	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'j'}})
 	mod := updated.(*model)
@@ -152,11 +238,40 @@ func TestUpdate_KeyMsg(t *testing.T) {
 	}
 }
 
+// TestUpdate_QuitShutdown stops services before quitting, and quits at once on a second press.
+func TestUpdate_QuitShutdown(t *testing.T) {
+	services := []config.ServiceConfig{{Name: "a"}}
+	mod := NewModel(services, nil, nil, nil)
+	stopped := false
+	mod.shutdown = func() { stopped = true }
+
+	var m tea.Model = mod
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'q'}})
+	if cmd == nil {
+		t.Fatal("expected non-nil cmd for quit")
+	}
+	if msg := cmd(); msg != tea.Quit() {
+		t.Errorf("expected Quit() message after shutdown, got %v", msg)
+	}
+	if !stopped {
+		t.Error("expected shutdown to run before quitting")
+	}
+
+	stopped = false
+	_, cmd = updated.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'q'}})
+	if msg := cmd(); msg != tea.Quit() {
+		t.Errorf("expected Quit() message on second press, got %v", msg)
+	}
+	if stopped {
+		t.Error("expected second quit to skip shutdown")
+	}
+}
+
 // TestView includes service names and logs for selected.
 func TestView(t *testing.T) {
 	services := []config.ServiceConfig{{Name: "x"}}
 	// ensure View() returns help text without error
-	var m tea.Model = NewModel(services, nil, "", "")
+	var m tea.Model = NewModel(services, nil, nil, nil)
 	v := m.View()
 	if v == "" {
 		t.Error("expected non-empty view output")
@@ -166,3 +281,84 @@ func TestView(t *testing.T) {
 	}
 }
 
+// fakeController records control calls made from the TUI.
+type fakeController struct {
+	calls  []string
+	active bool
+	err    error
+}
+
+func (f *fakeController) Start(name string) error {
+	f.calls = append(f.calls, "start:"+name)
+	return f.err
+}
+
+func (f *fakeController) Stop(name string) error {
+	f.calls = append(f.calls, "stop:"+name)
+	return f.err
+}
+
+func (f *fakeController) Restart(name string) error {
+	f.calls = append(f.calls, "restart:"+name)
+	return f.err
+}
+
+func (f *fakeController) RestartAll() { f.calls = append(f.calls, "restart-all") }
+
+func (f *fakeController) Status(name string) (supervisor.Info, error) {
+	return supervisor.Info{Name: name, Active: f.active}, nil
+}
+
+// TestUpdate_ControlKeys acts on the selected service.
+func TestUpdate_ControlKeys(t *testing.T) {
+	services := []config.ServiceConfig{{Name: "a"}, {Name: "b"}}
+	ctl := &fakeController{active: true}
+	mod := NewModel(services, nil, nil, nil)
+	mod.ctl = ctl
+
+	var m tea.Model = mod
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'j'}})
+	for _, r := range []rune{'r', 's', 'R'} {
+		var cmd tea.Cmd
+		m, cmd = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		if cmd == nil {
+			t.Fatalf("expected command for key %q", r)
+		}
+		if msg := cmd(); msg != nil {
+			t.Errorf("key %q: expected no message, got %v", r, msg)
+		}
+	}
+	// a stopped service is started by the toggle key
+	ctl.active = false
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'s'}})
+	cmd()
+
+	want := []string{"restart:b", "stop:b", "restart-all", "start:b"}
+	if !reflect.DeepEqual(ctl.calls, want) {
+		t.Errorf("expected calls %v, got %v", want, ctl.calls)
+	}
+}
+
+// TestUpdate_ControlError reports failures in the service log.
+func TestUpdate_ControlError(t *testing.T) {
+	services := []config.ServiceConfig{{Name: "a"}}
+	mod := NewModel(services, nil, nil, nil)
+	mod.ctl = &fakeController{err: errors.New("boom")}
+
+	_, cmd := mod.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'r'}})
+	msg, ok := cmd().(LogMsg)
+	if !ok || msg.Service != "a" || !strings.Contains(msg.Line, "boom") {
+		t.Fatalf("expected LogMsg with error for a, got %v", msg)
+	}
+}
+
+// TestUpdate_ControlKeysWithoutController ignores control keys.
+func TestUpdate_ControlKeysWithoutController(t *testing.T) {
+	services := []config.ServiceConfig{{Name: "a"}}
+	var m tea.Model = NewModel(services, nil, nil, nil)
+	for _, r := range []rune{'r', 's', 'R'} {
+		if _, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}}); cmd != nil {
+			t.Errorf("key %q: expected no command without a controller", r)
+		}
+	}
+}
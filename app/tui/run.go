@@ -2,15 +2,17 @@ package tui
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
-	"sync"
 	"time"
 
 	"github.com/simiancreative/treehouse/app/config"
+	"github.com/simiancreative/treehouse/app/control"
 	"github.com/simiancreative/treehouse/app/health"
 	"github.com/simiancreative/treehouse/app/service"
+	"github.com/simiancreative/treehouse/app/supervisor"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -27,136 +29,160 @@ type StatusMsg struct {
 	Status  string
 }
 
-func serviceTextHandler(svcName string, p *tea.Program) func(string) {
-	return func(line string) {
-		p.Send(LogMsg{Service: svcName, Line: line})
-	}
+// HealthMsg carries the result of a single health check attempt.
+type HealthMsg struct {
+	Service string
+	Result  health.Result
 }
 
-func statusCallbackHandler(svcName string, p *tea.Program) func(string) {
-	return func(status string) {
-		p.Send(StatusMsg{Service: svcName, Status: status})
-	}
+// RestartMsg reports that a service is about to be restarted.
+type RestartMsg struct {
+	Service string
+	Attempt int
+	Delay   time.Duration
+}
+
+// Options configures a TUI run.
+type Options struct {
+	ConfigDir string
+	// ConfigFiles, if set, are loaded instead of the files in ConfigDir.
+	ConfigFiles []string
+	Mode        string
+	// Focus and Mute hold service names or glob patterns, optionally
+	// comma-separated.
+	Focus, Mute []string
+	// Services selects the services to run and their modes; nil runs all core services.
+	Services []config.Selection
+	// Socket is the path of the control API socket; empty disables the API.
+	Socket string
+	// DefaultSocket reports that Socket is the default path rather than one
+	// given with --socket. When another treehouse is using it, the TUI runs
+	// without the API.
+	DefaultSocket bool
 }
 
 // Run initializes and runs the interactive TUI, orchestrating service processes and health checks.
 //
 // 1. Load services and health entries
 // 2. Initialize Bubble Tea model and program
-// 3. Setup cancellation context for subprocesses
-// 4. Launch each service in its own goroutine:
+// 3. Start each service under a supervisor:
+//   - Wait for its depends_on services to be started or healthy
 //   - Send status updates (starting, running, crashed, exited)
 //   - Stream stdout/stderr as log messages
 //
-// 5. Launch health check goroutines:
+// 4. Launch a health check goroutine once each service starts:
 //   - Poll URLs until healthy or timeout, sending status updates
+//   - Keep probing services with a liveness setting, flipping their status
+//   - Send every attempt to the health history in the details pane
 //
+// 5. Serve the control API on the socket, if set
 // 6. Start the TUI event loop (blocking)
-func Run(configDir, mode, focus, mute string) error {
+// 7. Stop services in reverse start order on quit
+func Run(opts Options) error {
 	// Load the consolidated configuration
-	cfg, err := config.LoadConfig(configDir + "/treehouse.yaml")
+	cfg, err := config.Load(opts.ConfigDir, opts.ConfigFiles, opts.Mode)
 	if err != nil {
 		return fmt.Errorf("error loading config: %w", err)
 	}
 
-	// Set environment variables
-	for k, v := range cfg.GlobalEnv {
-		os.Setenv(k, v)
+	// Resolve the selected services (all core services by default)
+	services, err := cfg.ResolveServices(opts.Services, opts.Mode)
+	if err != nil {
+		return fmt.Errorf("getting service config: %w", err)
 	}
 
-	// Convert core services to service configs
-	var services []config.ServiceConfig
 	var healthChecks = make(map[string]config.HealthEntry)
-
-	for name, svc := range cfg.CoreServices {
-		serviceConfig, err := cfg.GetServiceConfig(name, mode)
-		if err != nil {
-			return fmt.Errorf("getting service config: %w", err)
-		}
-		services = append(services, *serviceConfig)
-
-		// Set service-specific environment variables
-		for k, v := range svc.Env {
-			os.Setenv(k, v)
-		}
-
+	envs := make(map[string][]string, len(services))
+	for _, svc := range services {
+		envs[svc.Name] = svc.Environ()
 		// Get health check if configured
-		if hc, err := cfg.GetHealthCheck(name); err == nil {
-			healthChecks[name] = *hc
+		if hc, err := cfg.GetHealthCheck(svc.Name, svc.Mode); err == nil && hc.Enabled() {
+			healthChecks[svc.Name] = *hc
 		}
 	}
 
 	// Initialize the TUI model and program
-	model := NewModel(services, healthChecks, focus, mute)
+	model := NewModel(services, healthChecks, opts.Focus, opts.Mute)
 	p := tea.NewProgram(model, tea.WithAltScreen())
 
-	// Setup cancellation context for subprocesses
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Launch each service process and stream its output to the TUI
-	var svcWg sync.WaitGroup
-	svcWg.Add(len(services))
-
-	for _, svc := range services {
-		textHandler := serviceTextHandler(svc.Name, p)
-		statusHandler := statusCallbackHandler(svc.Name, p)
-
-		svc := svc // Capture the loop variable
-
-		go func() {
-			defer svcWg.Done()
-
-			err := service.
-				New().
-				SetConfig(svc).
-				SetStdOutCallback(textHandler).
-				SetStdErrCallback(textHandler).
-				SetStatusCallback(statusHandler).
-				Start(ctx)
-
-			if err != nil {
-				p.Send(StatusMsg{Service: svc.Name, Status: "Error"})
-			}
-		}()
+	// Supervise each service process, streaming its output, status and health
+	// check results to the TUI. Services start once their dependencies are ready.
+	var sup *supervisor.Supervisor
+	record := func(name string) func(health.Result) {
+		return func(res health.Result) {
+			sup.RecordProbe(name, res)
+		}
 	}
-
-	// Launch health check goroutines that send status updates to the TUI
-	for name, entry := range healthChecks {
-		name := name
-		entry := entry
-		go func() {
-			interval := entry.IntervalSeconds
-			if interval <= 0 {
-				interval = health.DefaultHealthInterval
-			}
-			timeout := entry.TimeoutSeconds
-			if timeout <= 0 {
-				timeout = health.DefaultHealthTimeout
-			}
-			start := time.Now()
-			for {
-				ok, _, err := health.CheckStatus(http.DefaultClient, entry.URL, entry.Codes)
-				if err == nil && ok {
-					p.Send(StatusMsg{Service: name, Status: "Healthy"})
-					return
-				}
-				if time.Since(start) > time.Duration(timeout)*time.Second {
-					p.Send(StatusMsg{Service: name, Status: "Unhealthy"})
-					return
-				}
-				time.Sleep(time.Duration(interval) * time.Second)
-			}
-		}()
+	sup = supervisor.New(supervisor.Options{
+		Services:     services,
+		HealthChecks: healthChecks,
+	}).
+		SetLogCallback(func(name, line string) {
+			p.Send(LogMsg{Service: name, Line: line})
+		}).
+		SetStatusCallback(func(name, status string) {
+			p.Send(StatusMsg{Service: name, Status: status})
+		}).
+		SetRestartCallback(func(name string, attempt int, delay time.Duration) {
+			p.Send(LogMsg{Service: name, Line: fmt.Sprintf("restarting in %s (restart %d)", delay, attempt)})
+			p.Send(RestartMsg{Service: name, Attempt: attempt, Delay: delay})
+		}).
+		SetErrorCallback(func(name string, err error) {
+			p.Send(LogMsg{Service: name, Line: err.Error()})
+			p.Send(StatusMsg{Service: name, Status: service.Statuses["Error"]})
+		}).
+		SetProbeCallback(func(name string, res health.Result) {
+			p.Send(HealthMsg{Service: name, Result: res})
+		}).
+		SetHealthCheck(func(ctx context.Context, name string, entry config.HealthEntry) bool {
+			return newProber(entry, envs[name], record(name)).Run(ctx).OK
+		}).
+		SetLivenessProbe(func(ctx context.Context, name string, entry config.HealthEntry) bool {
+			return newProber(entry, envs[name], record(name)).Probe(ctx).OK
+		})
+
+	// Serve the control API; changes made through it reach the TUI through
+	// the same callbacks
+	if opts.Socket != "" {
+		srv, err := control.Listen(opts.Socket, sup)
+		switch {
+		case err == nil:
+			defer srv.Close()
+		case opts.DefaultSocket && errors.Is(err, control.ErrInUse):
+			fmt.Fprintf(os.Stderr, "warning: %v, running without the control API\n", err)
+		default:
+			return err
+		}
 	}
 
+	sup.StartAll()
+
+	// Control the selected service from the TUI, and stop services in reverse
+	// start order when the user quits, while the TUI still shows their status
+	model.ctl = sup
+	model.shutdown = sup.StopAll
+
 	// Run the Bubble Tea event loop (blocks until the user exits)
 	if _, err := p.Run(); err != nil {
+		sup.StopAll()
 		return fmt.Errorf("error starting TUI: %w", err)
 	}
 
-	cancel() // Cancel the context to stop all subprocesses
-	svcWg.Wait()
+	sup.StopAll() // Stop any services still running
+	sup.Wait()
 
 	return nil
 }
+
+// newProber creates a prober for a health check with the default interval and
+// timeout that reports each attempt to onResult. Command checks run with env.
+func newProber(entry config.HealthEntry, env []string, onResult func(health.Result)) *health.Prober {
+	p := health.NewProber(
+		entry,
+		health.NewChecker(entry, http.DefaultClient, env),
+		health.DefaultHealthInterval*time.Second,
+		health.DefaultHealthTimeout*time.Second,
+	)
+	p.OnResult = onResult
+	return p
+}
@@ -10,7 +10,7 @@ import (
 func TestRun_ProcfileMissing(t *testing.T) {
    dir := t.TempDir()
    // No Procfile.test present
-   err := Run(dir, "test", "", "")
+   err := Run(Options{ConfigDir: dir, Mode: "test"})
    if err == nil {
        t.Fatal("expected error when Procfile is missing, got nil")
    }
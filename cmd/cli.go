@@ -3,8 +3,13 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/simiancreative/treehouse/app"
+	"github.com/simiancreative/treehouse/app/config"
+	"github.com/simiancreative/treehouse/app/contexts"
+	"github.com/simiancreative/treehouse/app/control"
 
 	"github.com/urfave/cli/v2"
 )
@@ -16,14 +21,21 @@ func Execute() {
 		Usage: "Development control tool",
 		Flags: []cli.Flag{
 			&cli.StringFlag{Name: "config-dir", Aliases: []string{"c"}, Value: "configs", Usage: "Directory containing config files"},
+			&cli.StringSliceFlag{Name: "config", Usage: "Config file to load instead of the config dir (repeatable, later files override earlier ones)"},
 			&cli.StringFlag{Name: "mode", Aliases: []string{"m"}, Value: "dev", Usage: "Mode to run (e.g., dev, prod)"},
-			&cli.StringFlag{Name: "focus", Aliases: []string{"f"}, Value: "", Usage: "Service to focus on"},
-			&cli.StringFlag{Name: "mute", Value: "", Usage: "Service to mute"},
+			&cli.StringSliceFlag{Name: "focus", Aliases: []string{"f"}, Usage: "Services to focus on, by name or glob (repeatable, comma-separated)"},
+			&cli.StringSliceFlag{Name: "mute", Usage: "Services to mute, by name or glob (repeatable, comma-separated)"},
+			&cli.StringFlag{Name: "socket", Usage: "Control API socket path (default: .treehouse.sock in the config dir, empty to disable)"},
 		},
 		Commands: []*cli.Command{
 			{
 				Name:  "start",
 				Usage: "Start all services with full TUI",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "profile", Usage: "Start only the services of a profile"},
+					&cli.StringSliceFlag{Name: "with", Usage: "Optional service to start as well (repeatable)"},
+					&cli.BoolFlag{Name: "with-all-optional", Usage: "Start every optional service as well"},
+				},
 				Action: func(c *cli.Context) error {
 					return runWithOptions(c, false)
 				},
@@ -47,6 +59,45 @@ func Execute() {
 					return runComposeMode(c)
 				},
 			},
+			{
+				Name:  "validate",
+				Usage: "Check the config for unknown keys and invalid settings",
+				Action: func(c *cli.Context) error {
+					return runValidate(c)
+				},
+			},
+			{
+				Name:  "status",
+				Usage: "Show the services of a running treehouse",
+				Action: func(c *cli.Context) error {
+					return runStatus(c)
+				},
+			},
+			{
+				Name:      "logs",
+				Usage:     "Print the buffered output of a service in a running treehouse",
+				UsageText: "treehouse logs [-f] SERVICE_NAME",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "follow", Aliases: []string{"f"}, Usage: "Keep printing new output"},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return cli.Exit("logs command requires exactly one service name argument", 1)
+					}
+					return runLogs(c, c.Args().Get(0))
+				},
+			},
+			{
+				Name:      "restart",
+				Usage:     "Restart a service in a running treehouse",
+				UsageText: "treehouse restart SERVICE_NAME",
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return cli.Exit("restart command requires exactly one service name argument", 1)
+					}
+					return runRestart(c, c.Args().Get(0))
+				},
+			},
 		},
 	}
 
@@ -59,9 +110,15 @@ func Execute() {
 func runWithOptions(c *cli.Context, noTUI bool) error {
 	err := app.New().
 		SetConfigDir(c.String("config-dir")).
+		SetConfigFiles(c.StringSlice("config")).
 		SetMode(c.String("mode")).
-		SetFocus(c.String("focus")).
-		SetMute(c.String("mute")).
+		SetFocus(c.StringSlice("focus")...).
+		SetMute(c.StringSlice("mute")...).
+		SetSocket(socketPath(c)).
+		SetDefaultSocket(!c.IsSet("socket")).
+		SetProfile(c.String("profile")).
+		SetWith(c.StringSlice("with")).
+		SetWithAllOptional(c.Bool("with-all-optional")).
 		SetTUI(noTUI).
 		Run()
 
@@ -78,11 +135,12 @@ func runSingleService(c *cli.Context, serviceName string) error {
 	// Create a new app instance with SPM mode enabled
 	err := app.New().
 		SetConfigDir(c.String("config-dir")).
+		SetConfigFiles(c.StringSlice("config")).
 		SetMode(c.String("mode")).
-		SetFocus(serviceName). // Use focus to select the single service
-		SetMute("").           // Mute all other services
-		SetTUI(true).          // Disable TUI
-		SetSPMMode(true).      // Enable SPM mode to only run health checks for the focused service
+		SetFocus(serviceName).         // Use focus to select the single service
+		SetTUI(true).                  // Disable TUI
+		SetSPMMode(true).              // Enable SPM mode to only run health checks for the focused service
+		SetSocket(c.String("socket")). // Only serve the API when --socket is given
 		Run()
 
 	if err != nil {
@@ -95,12 +153,83 @@ func runSingleService(c *cli.Context, serviceName string) error {
 
 // runComposeMode runs the application in compose mode with service selection
 func runComposeMode(c *cli.Context) error {
-	// TODO: Implement compose mode with service selection
-	// This will require:
-	// 1. Loading the config
-	// 2. Creating a TUI menu for service selection
-	// 3. Creating a TUI menu for mode selection per service
-	// 4. Running the selected services with their chosen modes
-	fmt.Println("Compose mode not yet implemented")
-	return cli.Exit("Not implemented", 1)
+	err := app.New().
+		SetConfigDir(c.String("config-dir")).
+		SetConfigFiles(c.StringSlice("config")).
+		SetMode(c.String("mode")).
+		SetFocus(c.StringSlice("focus")...).
+		SetMute(c.StringSlice("mute")...).
+		SetSocket(socketPath(c)).
+		SetDefaultSocket(!c.IsSet("socket")).
+		SetCompose(true).
+		Run()
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return cli.Exit("", 1)
+	}
+
+	return nil
+}
+
+// socketPath returns the --socket flag when it is set, or the default socket
+// in the config directory. With --config files the directory of the first
+// file is used, matching where .env.<mode> files are looked up.
+func socketPath(c *cli.Context) string {
+	if c.IsSet("socket") {
+		return c.String("socket")
+	}
+	if files := c.StringSlice("config"); len(files) > 0 {
+		return control.SocketPath(filepath.Dir(files[0]))
+	}
+	return control.SocketPath(c.String("config-dir"))
+}
+
+// runValidate loads the config with every check and reports its issues
+func runValidate(c *cli.Context) error {
+	cfg, err := config.Load(c.String("config-dir"), c.StringSlice("config"), c.String("mode"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return cli.Exit("", 1)
+	}
+
+	fmt.Printf("config is valid: %d core and %d optional services\n", len(cfg.CoreServices), len(cfg.OptionalServices))
+	return nil
+}
+
+// runStatus prints the services of a running treehouse as a table
+func runStatus(c *cli.Context) error {
+	infos, err := control.NewClient(socketPath(c)).List(c.Context)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return cli.Exit("", 1)
+	}
+
+	return control.WriteStatus(os.Stdout, infos, time.Now())
+}
+
+// runLogs prints or follows the buffered output of a service in a running treehouse
+func runLogs(c *cli.Context, serviceName string) error {
+	ctx, cancel := contexts.WithSignalCancel(c.Context)
+	defer cancel()
+
+	err := control.NewClient(socketPath(c)).Logs(ctx, serviceName, c.Bool("follow"), os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return cli.Exit("", 1)
+	}
+
+	return nil
+}
+
+// runRestart restarts a service in a running treehouse
+func runRestart(c *cli.Context, serviceName string) error {
+	info, err := control.NewClient(socketPath(c)).Restart(c.Context, serviceName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return cli.Exit("", 1)
+	}
+
+	fmt.Printf("%s: %s\n", info.Name, info.Status)
+	return nil
 }
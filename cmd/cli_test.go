@@ -16,8 +16,8 @@ func makeContext(configDir, mode, focus, mute string, command string, args ...st
 	set := flag.NewFlagSet("test", flag.ContinueOnError)
 	set.String("config-dir", "", "")
 	set.String("mode", "", "")
-	set.String("focus", "", "")
-	set.String("mute", "", "")
+	set.Var(cli.NewStringSlice(), "focus", "")
+	set.Var(cli.NewStringSlice(), "mute", "")
 	// Build args
 	cmdArgs := []string{"--config-dir", configDir, "--mode", mode}
 	if focus != "" {
@@ -27,7 +27,7 @@ func makeContext(configDir, mode, focus, mute string, command string, args ...st
 		cmdArgs = append(cmdArgs, "--mute", mute)
 	}
 	if command != "" {
-		cmdArgs = append([]string{command}, cmdArgs...)
+		cmdArgs = append(cmdArgs, command)
 	}
 	cmdArgs = append(cmdArgs, args...)
 	set.Parse(cmdArgs)
@@ -140,8 +140,8 @@ func TestConfigMissing(t *testing.T) {
 	})
 }
 
-// TestCompose_NotImplemented ensures compose command returns not implemented error.
-func TestCompose_NotImplemented(t *testing.T) {
+// TestCompose_ConfigMissing ensures compose command returns ExitCoder when config is absent.
+func TestCompose_ConfigMissing(t *testing.T) {
 	dir := t.TempDir()
 	c := makeContext(dir, "test", "", "", "compose")
 	var exitCoder cli.ExitCoder
@@ -155,3 +155,87 @@ func TestCompose_NotImplemented(t *testing.T) {
 		}
 	})
 }
+
+// TestClientCommands_NotRunning ensures status, logs and restart return
+// ExitCoder when no treehouse is listening on the socket.
+func TestClientCommands_NotRunning(t *testing.T) {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.String("config-dir", t.TempDir(), "")
+	c := cli.NewContext(&cli.App{}, set, nil)
+
+	commands := map[string]func() error{
+		"status":  func() error { return runStatus(c) },
+		"logs":    func() error { return runLogs(c, "svc") },
+		"restart": func() error { return runRestart(c, "svc") },
+	}
+	for name, run := range commands {
+		var exitCoder cli.ExitCoder
+		suppressOutput(func() {
+			err := run()
+			if !errors.As(err, &exitCoder) {
+				t.Fatalf("%s: expected cli.ExitCoder, got %v", name, err)
+			}
+			if exitCoder.ExitCode() != 1 {
+				t.Errorf("%s: expected exit code 1, got %d", name, exitCoder.ExitCode())
+			}
+		})
+	}
+}
+
+// TestSocketPath ensures the socket defaults to the config dir, or the
+// directory of the first --config file, and that --socket overrides it.
+func TestSocketPath(t *testing.T) {
+	newContext := func(args ...string) *cli.Context {
+		set := flag.NewFlagSet("test", flag.ContinueOnError)
+		set.String("config-dir", "configs", "")
+		set.Var(cli.NewStringSlice(), "config", "")
+		set.String("socket", "", "")
+		if err := set.Parse(args); err != nil {
+			t.Fatalf("parsing flags: %v", err)
+		}
+		return cli.NewContext(&cli.App{}, set, nil)
+	}
+
+	tests := map[string]struct {
+		args []string
+		want string
+	}{
+		"config dir":   {nil, filepath.Join("configs", ".treehouse.sock")},
+		"other dir":    {[]string{"--config-dir", "/project/configs"}, "/project/configs/.treehouse.sock"},
+		"config files": {[]string{"--config", "deploy/a.yaml", "--config", "b.yaml"}, filepath.Join("deploy", ".treehouse.sock")},
+		"explicit":     {[]string{"--socket", "/tmp/th.sock"}, "/tmp/th.sock"},
+		"disabled":     {[]string{"--socket", ""}, ""},
+	}
+	for name, tt := range tests {
+		if got := socketPath(newContext(tt.args...)); got != tt.want {
+			t.Errorf("%s: got %q, want %q", name, got, tt.want)
+		}
+	}
+}
+
+// TestValidate ensures validate returns nil for a valid config and ExitCoder
+// for an invalid one.
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	config := "core_services:\n  svc:\n    command: \"echo ok\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "treehouse.yaml"), []byte(config), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+	c := makeContext(dir, "test", "", "", "validate")
+	suppressOutput(func() {
+		if err := runValidate(c); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	config = "core_services:\n  svc:\n    cmd: \"echo ok\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "treehouse.yaml"), []byte(config), 0644); err != nil {
+		t.Fatalf("writing config file: %v", err)
+	}
+	suppressOutput(func() {
+		var exitCoder cli.ExitCoder
+		if err := runValidate(c); !errors.As(err, &exitCoder) {
+			t.Fatalf("expected cli.ExitCoder, got %v", err)
+		}
+	})
+}